@@ -0,0 +1,63 @@
+// Command admin manages user roles directly in the database.
+//
+// Usage:
+//
+//	admin [-db dsn] grant <email> <role>
+//	admin [-db dsn] revoke <email> <role>
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/services"
+)
+
+func main() {
+	dsn := flag.String("db", "./data.db?_busy_timeout=5000", "SQLite database to manage")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-db dsn] grant|revoke <email> <role>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := sql.Open("sqlite3", *dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	roleService := services.NewRoleService(db)
+	ctx := context.Background()
+	command, email, role := flag.Arg(0), flag.Arg(1), domain.Role(flag.Arg(2))
+
+	var done string
+	switch command {
+	case "grant":
+		_, err = roleService.AssignRoleByEmail(ctx, email, role)
+		done = "granted to"
+	case "revoke":
+		_, err = roleService.RemoveRoleByEmail(ctx, email, role)
+		done = "revoked from"
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to %s %s role: %v\n", command, role, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s role %s %s\n", role, done, email)
+}
@@ -1,59 +1,228 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/thantko20/tubbym-backend/internal/auth"
+	"github.com/thantko20/tubbym-backend/internal/config"
+	"github.com/thantko20/tubbym-backend/internal/domain"
 	"github.com/thantko20/tubbym-backend/internal/handlers"
+	"github.com/thantko20/tubbym-backend/internal/ingest"
+	"github.com/thantko20/tubbym-backend/internal/jobs"
+	"github.com/thantko20/tubbym-backend/internal/mailer"
+	"github.com/thantko20/tubbym-backend/internal/middleware"
 	"github.com/thantko20/tubbym-backend/internal/pubsub"
 	"github.com/thantko20/tubbym-backend/internal/services"
 	"github.com/thantko20/tubbym-backend/internal/storage"
 )
 
 func main() {
-	db, err := sql.Open("sqlite3", "./data.db")
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		return
+	}
+
+	db, err := sql.Open("sqlite3", "./data.db?_busy_timeout=5000")
 	if err != nil {
 		slog.Error("Failed to open database", "error", err)
 		return
 	}
 	defer db.Close()
 
-	store, err := storage.NewS3Storage("tubbym-test")
+	if err := services.CheckFTS5(context.Background(), db); err != nil {
+		slog.Error("Database is missing full-text search support", "error", err)
+		return
+	}
+
+	var store storage.Storage
+	var localStore *storage.LocalStorage
+	switch cfg.StorageDriver {
+	case config.StorageDriverLocal:
+		localStore, err = storage.NewLocalStorage(cfg.LocalStorageDir, cfg.PublicBaseURL, cfg.StorageSigningSecret)
+		store = localStore
+	case config.StorageDriverS3:
+		store, err = storage.NewS3Storage(cfg.S3Bucket)
+	default:
+		slog.Error("Unknown storage driver", "driver", cfg.StorageDriver)
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to create storage", "error", err)
 		return
 	}
 
+	var mail mailer.Mailer
+	switch cfg.MailerDriver {
+	case config.MailerDriverLog:
+		if !cfg.DevMode {
+			slog.Warn("Emails will not be delivered, set MAILER_DRIVER=smtp to send them")
+		}
+		mail = mailer.NewLogMailer(cfg.DevMode)
+	case config.MailerDriverSMTP:
+		mail, err = mailer.NewSMTPMailer(cfg.SMTPAddr, cfg.MailFrom, cfg.SMTPUsername, cfg.SMTPPassword)
+	default:
+		slog.Error("Unknown mailer driver", "driver", cfg.MailerDriver)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to create mailer", "error", err)
+		return
+	}
+
 	// Create pubsub broker
 	broker := pubsub.NewBroker()
 	defer broker.Close()
 
-	videoService := services.NewVideoService(db, store, broker)
-	authService := auth.NewAuthService(db)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	queue := jobs.NewQueue(db)
+	videoService := services.NewVideoService(db, store, broker, queue, cfg.StreamingBaseURL, cfg.TranscodeLadder)
+	authService := auth.NewAuthService(db, mail, cfg.FrontendOrigins, auth.NewProvidersFromEnv(cfg.PublicBaseURL)...)
+	userService := services.NewUserService(db, store, cfg.PublicBaseURL)
+	roleService := services.NewRoleService(db)
+
+	if cfg.AdminBootstrapEmail != "" {
+		if _, err := roleService.AssignRoleByEmail(ctx, cfg.AdminBootstrapEmail, domain.RoleAdmin); err != nil {
+			// The user may not have signed up yet, so keep trying on every start
+			slog.Warn("Failed to bootstrap admin", "email", cfg.AdminBootstrapEmail, "error", err)
+		}
+	}
+
+	// Start the worker pool that processes queued videos
+	pool := jobs.NewPool(queue, cfg.JobWorkers)
+	pool.Register(services.JobTypeProcessVideo, videoService.HandleProcessVideoJob)
+	pool.OnFailed(services.JobTypeProcessVideo, videoService.HandleProcessVideoJobFailed)
+	if err := pool.Start(ctx); err != nil {
+		slog.Error("Failed to start job workers", "error", err)
+		return
+	}
+	defer pool.Wait()
+
+	// Permanently remove videos once they can no longer be restored
+	reaper := services.NewVideoReaper(videoService, cfg.VideoRetention, cfg.VideoReaperInterval, cfg.VideoReaperDryRun)
+	if cfg.VideoReaperInterval > 0 {
+		go reaper.Run(ctx)
+	}
+
+	// Confirm and process raw videos as soon as storage reports them written
+	handleStorageEvent := func(ctx context.Context, event ingest.Event) error {
+		return videoService.HandleObjectCreated(ctx, event.Key)
+	}
+	if localStore != nil {
+		go ingest.NewLocalSource(localStore).Run(ctx, handleStorageEvent)
+	}
 
 	// Create handlers
-	h := handlers.NewHandlers(videoService, authService)
+	h := handlers.NewHandlers(videoService, authService, userService, roleService)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		// Lets the local storage backend stream uploads to disk instead of buffering them
+		StreamRequestBody: localStore != nil,
+	})
 
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("Hello, World!")
 	})
 
+	requireAuth := middleware.RequireAuth(authService)
+	optionalAuth := middleware.OptionalAuth(authService)
+	// API tokens only reach routes their scopes allow, and never account management or admin routes
+	videosRead := middleware.RequireScope(domain.ScopeVideosRead)
+	videosWrite := middleware.RequireScope(domain.ScopeVideosWrite)
+	profileRead := middleware.RequireScope(domain.ScopeProfileRead)
+	profileWrite := middleware.RequireScope(domain.ScopeProfileWrite)
+	requireSession := middleware.RequireSession()
+	moderateVideos := h.RequirePermission(domain.PermVideosModerate)
+	manageUsers := h.RequirePermission(domain.PermUsersManage)
+	manageVideos := h.RequirePermission(domain.PermVideosManage)
+
 	// Video routes
-	app.Get("/videos", h.GetVideos)
-	app.Get("/videos/:id", h.GetVideoByID)
-	app.Post("/videos", h.CreateVideo)
-	app.Post("/videos/:id/process", h.ProcessVideo)
-	app.Get("/videos/:id/status", handlers.HandleVideoProcessingSSE(broker))
+	app.Get("/videos", optionalAuth, videosRead, h.GetVideos)
+	app.Get("/videos/search", h.SearchVideos)
+	app.Get("/videos/:id", optionalAuth, videosRead, h.GetVideoByID)
+	app.Post("/videos", requireAuth, videosWrite, h.CreateVideo)
+	app.Patch("/videos/:id", requireAuth, videosWrite, h.UpdateVideo)
+	app.Delete("/videos/:id", requireAuth, videosWrite, h.DeleteVideo)
+	app.Post("/videos/:id/restore", requireAuth, videosWrite, h.RestoreVideo)
+	app.Post("/videos/:id/upload/confirm", requireAuth, videosWrite, h.ConfirmUpload)
+	app.Post("/videos/:id/multipart", requireAuth, videosWrite, h.StartMultipartUpload)
+	app.Post("/videos/:id/multipart/parts", requireAuth, videosWrite, h.PresignUploadParts)
+	app.Get("/videos/:id/multipart/parts", requireAuth, videosWrite, h.ListUploadParts)
+	app.Post("/videos/:id/multipart/complete", requireAuth, videosWrite, h.CompleteMultipartUpload)
+	app.Delete("/videos/:id/multipart", requireAuth, videosWrite, h.AbortMultipartUpload)
+	app.Post("/videos/:id/process", requireAuth, videosWrite, h.ProcessVideo)
+	app.Post("/videos/:id/thumbnail", requireAuth, videosWrite, h.CreateThumbnailUpload)
+	app.Post("/videos/:id/thumbnail/confirm", requireAuth, videosWrite, h.ConfirmThumbnailUpload)
+	app.Post("/videos/:id/hide", requireAuth, requireSession, moderateVideos, h.HideVideo)
+	app.Post("/videos/:id/unhide", requireAuth, requireSession, moderateVideos, h.UnhideVideo)
+	app.Get("/videos/:id/status", optionalAuth, videosRead, h.HandleVideoProcessingSSE(broker))
+
+	// User routes
+	app.Get("/users/:id/videos", optionalAuth, videosRead, h.GetUserVideos)
+	app.Get("/users/:id/avatar/:file", h.GetProfilePic)
+	app.Get("/me", requireAuth, profileRead, h.GetMe)
+	app.Patch("/me", requireAuth, profileWrite, h.UpdateMe)
+	app.Post("/me/password", requireAuth, requireSession, h.ChangePassword)
+	app.Get("/me/sessions", requireAuth, requireSession, h.ListSessions)
+	app.Delete("/me/sessions", requireAuth, requireSession, h.RevokeOtherSessions)
+	app.Post("/me/sessions/rotate", requireAuth, requireSession, h.RotateSession)
+	app.Delete("/me/sessions/:id", requireAuth, requireSession, h.RevokeSession)
+	app.Get("/me/identities", requireAuth, requireSession, h.ListIdentities)
+	app.Get("/me/identities/:provider/link", requireAuth, requireSession, h.LinkProvider)
+	app.Delete("/me/identities/:provider", requireAuth, requireSession, h.UnlinkProvider)
+	app.Get("/me/tokens", requireAuth, requireSession, h.ListAPITokens)
+	app.Post("/me/tokens", requireAuth, requireSession, h.CreateAPIToken)
+	app.Delete("/me/tokens/:id", requireAuth, requireSession, h.RevokeAPIToken)
+	app.Get("/me/videos", requireAuth, videosRead, h.GetMyVideos)
+
+	// Admin routes
+	app.Get("/admin/users/:id", requireAuth, requireSession, manageUsers, h.GetUser)
+	app.Patch("/admin/users/:id", requireAuth, requireSession, manageUsers, h.UpdateUser)
+	app.Put("/admin/users/:id/roles/:role", requireAuth, requireSession, manageUsers, h.AssignRole)
+	app.Delete("/admin/users/:id/roles/:role", requireAuth, requireSession, manageUsers, h.RemoveRole)
+	app.Get("/admin/videos/purge", requireAuth, requireSession, manageVideos, handlers.HandlePurgeReport(reaper))
+
+	if cfg.IngestToken != "" {
+		app.Post("/ingest/s3-events", handlers.HandleS3Events(cfg.IngestToken, cfg.S3Bucket, handleStorageEvent))
+	}
 
 	// Auth routes
 	app.Get("/auth/:provider/login", h.LoginWithProvider)
 	app.Get("/auth/:provider/callback", h.HandleProviderCallback)
 	app.Post("/auth/logout", h.Logout)
+	app.Post("/auth/register", h.Register)
+	app.Post("/auth/login", h.LoginWithPassword)
+	app.Post("/auth/verify-email", h.VerifyEmail)
+	app.Post("/auth/verify-email/resend", h.ResendVerification)
+	app.Post("/auth/password/forgot", h.ForgotPassword)
+	app.Post("/auth/password/reset", h.ResetPassword)
 
-	app.Listen(":8080")
+	if localStore != nil {
+		// Browsers need the ETag header to complete multipart uploads
+		app.Use("/storage", cors.New(cors.Config{ExposeHeaders: fiber.HeaderETag}))
+		app.Put("/storage/upload/*", handlers.HandleLocalUpload(localStore))
+		app.Static("/storage/files/processed-videos", filepath.Join(localStore.Dir(), "processed-videos"))
+	}
+
+	go func() {
+		<-ctx.Done()
+		slog.Info("Shutting down")
+		app.Shutdown()
+	}()
+
+	if err := app.Listen(cfg.Addr); err != nil {
+		slog.Error("Server stopped", "error", err)
+		stop()
+	}
 }
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+const (
+	apiTokenBytes = 20
+	// Characters of the token, after its prefix, kept to identify it
+	apiTokenPrefixLength = 8
+	// How often a token's last use is written back
+	apiTokenTouchInterval = time.Minute
+)
+
+func (a *authService) CreateAPIToken(ctx context.Context, userID string, req domain.CreateAPITokenReq) (*domain.APIToken, string, error) {
+	if err := req.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	b := make([]byte, apiTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	secret := hex.EncodeToString(b)
+	token := domain.APITokenPrefix + secret
+
+	apiToken := &domain.APIToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: hashToken(token),
+		Prefix:    domain.APITokenPrefix + secret[:apiTokenPrefixLength],
+		Scopes:    req.Scopes,
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresInDays),
+		CreatedAt: time.Now(),
+	}
+
+	if err := a.apiTokenRepo.Create(ctx, apiToken); err != nil {
+		return nil, "", fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	return apiToken, token, nil
+}
+
+func (a *authService) ListAPITokens(ctx context.Context, userID string) ([]domain.APIToken, error) {
+	tokens, err := a.apiTokenRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (a *authService) RevokeAPIToken(ctx context.Context, userID string, tokenID string) error {
+	err := a.apiTokenRepo.Revoke(ctx, userID, tokenID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.NewAppError(domain.ErrCodeAPITokenNotFound, "API token not found", nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token: %w", err)
+	}
+	return nil
+}
+
+func (a *authService) ValidateAPIToken(ctx context.Context, token string) (*domain.ValidateSessionDTO, *domain.AppError) {
+	apiToken, user, err := a.apiTokenRepo.FindByTokenWithUser(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &domain.AppError{
+				Code:    domain.ErrCodeAuthInvalidSession,
+				Message: "Invalid or expired API token",
+				Err:     err,
+			}
+		}
+		slog.Error("Failed to validate API token", "error", err)
+		return nil, &domain.AppError{
+			Code:    domain.ErrCodeAuthInvalidSession,
+			Message: "API token validation failed",
+			Err:     err,
+		}
+	}
+
+	if now := time.Now(); apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) >= apiTokenTouchInterval {
+		if err := a.apiTokenRepo.MarkUsed(ctx, apiToken.ID, now); err != nil {
+			slog.Error("Failed to record API token use", "tokenId", apiToken.ID, "error", err)
+		}
+	}
+
+	return &domain.ValidateSessionDTO{User: *user, APIToken: apiToken}, nil
+}
@@ -4,47 +4,115 @@ import (
 	"context"
 	"crypto/rand"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/mailer"
 	"github.com/thantko20/tubbym-backend/internal/repository"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
 const (
 	sessionTokenBytes = 16
-	sessionDuration   = 7 * 24 * time.Hour
+	// Sessions expire after this long without use
+	sessionDuration = 7 * 24 * time.Hour
+	// How often activity on a session is written back
+	sessionTouchInterval = time.Minute
+	// How often cookie sessions get a new token
+	sessionRotationInterval = 24 * time.Hour
+	// How long a rotated-away token keeps working, for requests already in flight
+	sessionRotationGrace = time.Minute
+	// How long a user has to finish signing in with the provider
+	oauthStateDuration = 10 * time.Minute
 )
 
+// SessionMaxLifetime is how long a session lasts at most, however often it is used
+const SessionMaxLifetime = 30 * 24 * time.Hour
+
 var (
 	envOnce sync.Once
 )
 
 type AuthService interface {
-	LoginWithProvider(provider domain.AuthProvider) (string, error)
-	HandleProviderCallback(ctx context.Context, provider domain.AuthProvider, code string) (*domain.Session, error)
+	LoginWithProvider(ctx context.Context, provider domain.AuthProvider, redirectTo string) (*domain.LoginRedirect, error)
+	// LinkProvider starts the provider's OAuth flow to link its account to the signed-in user
+	LinkProvider(ctx context.Context, userID string, provider domain.AuthProvider, redirectTo string) (*domain.LoginRedirect, error)
+	// HandleProviderCallback finishes a login or link, returning where to send the user and,
+	// for logins, the new session
+	HandleProviderCallback(ctx context.Context, provider domain.AuthProvider, code string, state string, client domain.ClientInfo) (*domain.Session, string, error)
+	// DefaultRedirect is the frontend URL users are sent to when a login doesn't ask for another
+	DefaultRedirect() string
 	ValidateSession(token string) (*domain.ValidateSessionDTO, *domain.AppError)
+	// RefreshSession records activity on a validated session, extending its
+	// expiry. With rotate it also replaces a token that is due for rotation,
+	// returning the new token, or "" when the token stays the same.
+	RefreshSession(ctx context.Context, session *domain.Session, client domain.ClientInfo, rotate bool) (string, error)
+	// RotateSession replaces the session's token, returning the session with its new
+	// token. It fails with ErrCodeAuthSessionRotated when the token the session was
+	// authenticated with has already been replaced.
+	RotateSession(ctx context.Context, session *domain.Session) (*domain.Session, error)
+	// ListSessions returns the user's active sessions, marking the current one
+	ListSessions(ctx context.Context, current *domain.Session) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, userID string, sessionID string) error
+	// RevokeOtherSessions ends every session of the user except current
+	RevokeOtherSessions(ctx context.Context, current *domain.Session) error
 	Logout(ctx context.Context, token string) *domain.AppError
+
+	// CreateAPIToken creates a personal API token for the user, returning it
+	// with the token itself, which can't be retrieved again
+	CreateAPIToken(ctx context.Context, userID string, req domain.CreateAPITokenReq) (*domain.APIToken, string, error)
+	ListAPITokens(ctx context.Context, userID string) ([]domain.APIToken, error)
+	RevokeAPIToken(ctx context.Context, userID string, tokenID string) error
+	// ValidateAPIToken authenticates a request made with an API token instead of a session
+	ValidateAPIToken(ctx context.Context, token string) (*domain.ValidateSessionDTO, *domain.AppError)
+
+	// Register creates a password account and emails a verification link; it
+	// can't be used to sign in until the email is verified
+	Register(ctx context.Context, req domain.RegisterReq) (*domain.User, error)
+	LoginWithPassword(ctx context.Context, req domain.PasswordLoginReq, client domain.ClientInfo) (*domain.Session, error)
+	VerifyEmail(ctx context.Context, req domain.VerifyEmailReq) error
+	ResendVerification(ctx context.Context, req domain.EmailReq) error
+	RequestPasswordReset(ctx context.Context, req domain.EmailReq) error
+	// ResetPassword sets a new password with a mailed reset token and signs the user out everywhere
+	ResetPassword(ctx context.Context, req domain.ResetPasswordReq) error
+	// ChangePassword sets a new password and signs out every other session of the user
+	ChangePassword(ctx context.Context, session *domain.Session, req domain.ChangePasswordReq) error
+
+	ListIdentities(ctx context.Context, userID string) ([]domain.Identity, error)
+	// UnlinkProvider removes the user's linked provider account, unless it is their only way to sign in
+	UnlinkProvider(ctx context.Context, userID string, provider domain.AuthProvider) error
 }
 
 type authService struct {
-	userRepo    repository.UserRepository
-	sessionRepo repository.SessionRepository
-	httpClient  *http.Client
+	db              *sql.DB
+	userRepo        repository.UserRepository
+	sessionRepo     repository.SessionRepository
+	oauthStateRepo  repository.OAuthStateRepository
+	identityRepo    repository.IdentityRepository
+	credentialRepo  repository.CredentialRepository
+	authTokenRepo   repository.AuthTokenRepository
+	apiTokenRepo    repository.APITokenRepository
+	mailer          mailer.Mailer
+	httpClient      *http.Client
+	providers       map[domain.AuthProvider]Provider
+	frontendOrigins []string
 }
 
-// NewAuthService creates a new authentication service instance
-func NewAuthService(db *sql.DB) AuthService {
+// NewAuthService creates a new authentication service instance that signs
+// users in with a password or with providers. Logins may only redirect back to
+// frontendOrigins, and go to the first one by default, which is also where
+// emailed links point.
+func NewAuthService(db *sql.DB, mail mailer.Mailer, frontendOrigins []string, providers ...Provider) AuthService {
 	// Load environment variables only once
 	envOnce.Do(func() {
 		if err := godotenv.Load(); err != nil {
@@ -52,79 +120,154 @@ func NewAuthService(db *sql.DB) AuthService {
 		}
 	})
 
+	byName := make(map[domain.AuthProvider]Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+
 	return &authService{
-		userRepo:    repository.NewUserRepository(db),
-		sessionRepo: repository.NewSessionRepository(db),
-		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		db:              db,
+		userRepo:        repository.NewUserRepository(db),
+		sessionRepo:     repository.NewSessionRepository(db),
+		oauthStateRepo:  repository.NewOAuthStateRepository(db),
+		identityRepo:    repository.NewIdentityRepository(db),
+		credentialRepo:  repository.NewCredentialRepository(db),
+		authTokenRepo:   repository.NewAuthTokenRepository(db),
+		apiTokenRepo:    repository.NewAPITokenRepository(db),
+		mailer:          mail,
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		providers:       byName,
+		frontendOrigins: frontendOrigins,
 	}
 }
 
-func (a *authService) LoginWithProvider(provider domain.AuthProvider) (string, error) {
-	config, err := a.getProviderConfig(provider)
+func (a *authService) LoginWithProvider(ctx context.Context, provider domain.AuthProvider, redirectTo string) (*domain.LoginRedirect, error) {
+	return a.startOAuth(ctx, provider, redirectTo, "")
+}
+
+func (a *authService) LinkProvider(ctx context.Context, userID string, provider domain.AuthProvider, redirectTo string) (*domain.LoginRedirect, error) {
+	return a.startOAuth(ctx, provider, redirectTo, userID)
+}
+
+// startOAuth sends the user to provider to sign in, or to link the account to linkUserID when set
+func (a *authService) startOAuth(ctx context.Context, provider domain.AuthProvider, redirectTo string, linkUserID string) (*domain.LoginRedirect, error) {
+	p, err := a.getProvider(provider)
 	if err != nil {
-		return "", fmt.Errorf("failed to get provider config: %w", err)
+		return nil, err
+	}
+
+	redirectTo, err = a.validateRedirect(redirectTo)
+	if err != nil {
+		return nil, err
 	}
 
 	// Generate a secure random state parameter
 	state, err := a.generateSecureToken()
 	if err != nil {
-		return "", fmt.Errorf("failed to generate state parameter: %w", err)
+		return nil, fmt.Errorf("failed to generate state parameter: %w", err)
+	}
+
+	oauthState := &domain.OAuthState{
+		State:        state,
+		Provider:     provider,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		RedirectTo:   redirectTo,
+		LinkUserID:   linkUserID,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    time.Now().Add(oauthStateDuration),
+	}
+
+	if err := a.oauthStateRepo.Create(ctx, oauthState); err != nil {
+		return nil, fmt.Errorf("failed to store state parameter: %w", err)
 	}
 
-	url := config.AuthCodeURL(state)
-	return url, nil
+	return &domain.LoginRedirect{
+		URL:       p.Config().AuthCodeURL(state, oauth2.S256ChallengeOption(oauthState.CodeVerifier)),
+		State:     state,
+		ExpiresAt: oauthState.ExpiresAt,
+	}, nil
 }
 
-func (a *authService) HandleProviderCallback(ctx context.Context, provider domain.AuthProvider, code string) (*domain.Session, error) {
-	config, err := a.getProviderConfig(provider)
+func (a *authService) HandleProviderCallback(ctx context.Context, provider domain.AuthProvider, code string, state string, client domain.ClientInfo) (*domain.Session, string, error) {
+	p, err := a.getProvider(provider)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get provider config: %w", err)
+		return nil, "", err
 	}
 
-	token, err := config.Exchange(ctx, code)
+	// States are single use, so a replayed callback fails here
+	oauthState, err := a.oauthStateRepo.Consume(ctx, state)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && oauthState.Provider != provider) {
+		return nil, "", domain.NewAppError(domain.ErrCodeAuthInvalidState, "Invalid or expired login state", nil)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load state parameter: %w", err)
+	}
+
+	// Make the oauth2 package use our client, with its timeout
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, a.httpClient)
+
+	token, err := p.Config().Exchange(ctx, code, oauth2.VerifierOption(oauthState.CodeVerifier))
 	if err != nil {
-		slog.Error("Failed to exchange code for token", "error", err)
-		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
+		slog.Error("Failed to exchange code for token", "provider", provider, "error", err)
+		return nil, "", fmt.Errorf("failed to exchange code for token: %w", err)
 	}
 
-	userInfo, err := a.fetchGoogleUserInfo(ctx, token.AccessToken)
+	userInfo, err := p.FetchUser(ctx, p.Config().Client(ctx, token))
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch user info: %w", err)
+		return nil, "", fmt.Errorf("failed to fetch user info: %w", err)
+	}
+
+	if oauthState.LinkUserID != "" {
+		if err := a.linkIdentity(ctx, oauthState.LinkUserID, provider, userInfo); err != nil {
+			return nil, "", err
+		}
+		return nil, oauthState.RedirectTo, nil
 	}
 
-	user, err := a.findOrCreateUser(ctx, userInfo)
+	user, err := a.findOrCreateUser(ctx, provider, userInfo)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find or create user: %w", err)
+		return nil, "", err
 	}
 
-	session, err := a.createSession(ctx, user.ID, provider)
+	session, err := a.createSession(ctx, user.ID, provider, client)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create session: %w", err)
+		return nil, "", fmt.Errorf("failed to create session: %w", err)
 	}
 
-	return session, nil
+	return session, oauthState.RedirectTo, nil
 }
 
-func (a *authService) getProviderConfig(provider domain.AuthProvider) (*oauth2.Config, error) {
-	switch provider {
-	case domain.AuthProviderGoogle:
-		clientID := os.Getenv("GOOGLE_CLIENT_ID")
-		clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
+func (a *authService) DefaultRedirect() string {
+	if len(a.frontendOrigins) == 0 {
+		return "/"
+	}
+	return a.frontendOrigins[0] + "/"
+}
+
+// validateRedirect checks that redirectTo is an absolute URL on one of the
+// frontend origins, so logins can't be used to bounce users to other sites
+func (a *authService) validateRedirect(redirectTo string) (string, error) {
+	if redirectTo == "" {
+		return a.DefaultRedirect(), nil
+	}
 
-		if clientID == "" || clientSecret == "" {
-			return nil, fmt.Errorf("missing Google OAuth credentials in environment")
+	u, err := url.Parse(redirectTo)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil {
+		origin := u.Scheme + "://" + strings.ToLower(u.Host)
+		if slices.Contains(a.frontendOrigins, origin) {
+			return u.String(), nil
 		}
+	}
 
-		return &oauth2.Config{
-			ClientID:     clientID,
-			ClientSecret: clientSecret,
-			RedirectURL:  "http://localhost:8080/auth/google/callback",
-			Endpoint:     google.Endpoint,
-			Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
-		}, nil
-	default:
-		return nil, fmt.Errorf("unsupported provider: %s", provider)
+	return "", domain.NewAppError(domain.ErrCodeAuthInvalidRedirect, "redirect_to must be on an allowed frontend origin", nil)
+}
+
+func (a *authService) getProvider(provider domain.AuthProvider) (Provider, error) {
+	p, ok := a.providers[provider]
+	if !ok {
+		return nil, domain.NewAppError(domain.ErrCodeAuthInvalidProvider, fmt.Sprintf("Unsupported provider: %s", provider), nil)
 	}
+	return p, nil
 }
 
 // generateSecureToken generates a cryptographically secure random token
@@ -136,122 +279,184 @@ func (a *authService) generateSecureToken() (string, error) {
 	return fmt.Sprintf("%x", b), nil
 }
 
-// googleUserInfo represents the user information from Google OAuth
-type googleUserInfo struct {
-	Sub     string `json:"sub"`
-	Name    string `json:"name"`
-	Picture string `json:"picture"`
-	Email   string `json:"email"`
-}
-
-// fetchGoogleUserInfo fetches user information from Google using the access token
-func (a *authService) fetchGoogleUserInfo(ctx context.Context, accessToken string) (*googleUserInfo, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/oauth2/v3/userinfo", nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// findOrCreateUser finds the user the provider account is linked to, creating
+// one on its first login
+func (a *authService) findOrCreateUser(ctx context.Context, provider domain.AuthProvider, userInfo *ProviderUser) (*domain.User, error) {
+	identity, err := a.identityRepo.FindByProviderSubject(ctx, provider, userInfo.Subject)
+	if err == nil {
+		user, err := a.userRepo.FindByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query user: %w", err)
+		}
+		return user, nil
 	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to query identity: %w", err)
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Google API returned status %d", res.StatusCode)
+	user, err := a.userRepo.FindByEmail(ctx, userInfo.Email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if user, err = a.createUser(ctx, userInfo); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	default:
+		if err := a.checkClaimByEmail(ctx, user); err != nil {
+			return nil, err
+		}
 	}
 
-	var userInfo googleUserInfo
-	if err := json.NewDecoder(res.Body).Decode(&userInfo); err != nil {
-		return nil, fmt.Errorf("failed to decode user info: %w", err)
+	if err := a.linkIdentity(ctx, user.ID, provider, userInfo); err != nil {
+		return nil, err
 	}
 
-	return &userInfo, nil
+	return user, nil
 }
 
-// findOrCreateUser finds an existing user or creates a new one
-func (a *authService) findOrCreateUser(ctx context.Context, userInfo *googleUserInfo) (*domain.User, error) {
-	// Try to find existing user
-	user, err := a.userRepo.FindByEmail(ctx, userInfo.Email)
-	if err == nil {
-		return user, nil
+// checkClaimByEmail decides whether a provider login may take over the existing
+// account with the same email. Only accounts from before identities were
+// recorded, which have no other way to sign in, are linked automatically;
+// everyone else must sign in and link the provider themselves.
+func (a *authService) checkClaimByEmail(ctx context.Context, user *domain.User) error {
+	accountExists := domain.NewAppError(domain.ErrCodeAuthAccountExists, "An account with this email already exists; sign in and link the provider instead", nil)
+
+	// The provider has verified the email, so a password registered for it
+	// but never verified may belong to someone else
+	if err := a.credentialRepo.DeleteUnverified(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to remove unverified credential: %w", err)
 	}
 
-	if !errors.Is(err, sql.ErrNoRows) {
-		return nil, fmt.Errorf("failed to query user: %w", err)
+	identities, err := a.identityRepo.ListByUserID(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query identities: %w", err)
 	}
-
-	// User doesn't exist, create new one
-	return a.createUser(ctx, userInfo)
-}
-
-// createUser creates a new user in the database
-func (a *authService) createUser(ctx context.Context, userInfo *googleUserInfo) (*domain.User, error) {
-	user := &domain.User{
-		ID:         uuid.New().String(),
-		Name:       userInfo.Name,
-		Email:      userInfo.Email,
-		Username:   userInfo.Sub, // Use Google's sub as username for now
-		ProfilePic: userInfo.Picture,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+	if len(identities) > 0 {
+		return accountExists
 	}
 
-	if err := a.userRepo.Create(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+	_, err = a.credentialRepo.FindByUserID(ctx, user.ID)
+	if err == nil {
+		return accountExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to query credential: %w", err)
 	}
 
-	return user, nil
+	slog.Info("Linking provider to legacy account by email", "userId", user.ID)
+	return nil
 }
 
-func (a *authService) createSession(ctx context.Context, userID string, provider domain.AuthProvider) (*domain.Session, error) {
-	token, err := a.generateSecureToken()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate session token: %w", err)
-	}
-
-	session := &domain.Session{
+// linkIdentity links the provider account to the user, doing nothing if it already is
+func (a *authService) linkIdentity(ctx context.Context, userID string, provider domain.AuthProvider, userInfo *ProviderUser) error {
+	identity := &domain.Identity{
 		ID:        uuid.New().String(),
 		UserID:    userID,
-		Token:     token,
 		Provider:  provider,
-		ExpiredAt: time.Now().Add(sessionDuration),
+		Subject:   userInfo.Subject,
+		Email:     userInfo.Email,
 		CreatedAt: time.Now(),
 	}
 
-	if err := a.sessionRepo.Create(ctx, session); err != nil {
-		return nil, fmt.Errorf("failed to create session: %w", err)
+	err := a.identityRepo.Create(ctx, identity)
+	if errors.Is(err, repository.ErrIdentityTaken) {
+		existing, findErr := a.identityRepo.FindByProviderSubject(ctx, provider, userInfo.Subject)
+		if findErr == nil && existing.UserID == userID {
+			return nil
+		}
+		return domain.NewAppError(domain.ErrCodeAuthIdentityTaken, fmt.Sprintf("This %s account can't be linked because another one is already linked or it belongs to another user", provider), err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
 	}
 
-	return session, nil
+	return nil
+}
+
+func (a *authService) ListIdentities(ctx context.Context, userID string) ([]domain.Identity, error) {
+	identities, err := a.identityRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query identities: %w", err)
+	}
+	return identities, nil
 }
 
-func (a *authService) ValidateSession(token string) (*domain.ValidateSessionDTO, *domain.AppError) {
-	dto, err := a.sessionRepo.FindByTokenWithUser(context.Background(), token)
+func (a *authService) UnlinkProvider(ctx context.Context, userID string, provider domain.AuthProvider) error {
+	identities, err := a.identityRepo.ListByUserID(ctx, userID)
 	if err != nil {
+		return fmt.Errorf("failed to query identities: %w", err)
+	}
+
+	linked := slices.ContainsFunc(identities, func(identity domain.Identity) bool {
+		return identity.Provider == provider
+	})
+	if !linked {
+		return domain.NewAppError(domain.ErrCodeAuthIdentityNotFound, fmt.Sprintf("No %s account is linked", provider), nil)
+	}
+
+	if len(identities) == 1 {
+		_, err := a.credentialRepo.FindByUserID(ctx, userID)
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, &domain.AppError{
-				Code:    domain.ErrCodeAuthInvalidSession,
-				Message: "Invalid or expired session",
-				Err:     err,
-			}
+			return domain.NewAppError(domain.ErrCodeAuthLastLoginMethod, "Set a password or link another provider before unlinking your only way to sign in", nil)
 		}
-		slog.Error("Failed to validate session", "error", err)
-		return nil, &domain.AppError{
-			Code:    domain.ErrCodeAuthInvalidSession,
-			Message: "Session validation failed",
-			Err:     err,
+		if err != nil {
+			return fmt.Errorf("failed to query credential: %w", err)
 		}
 	}
 
-	return dto, nil
+	err = a.identityRepo.Delete(ctx, userID, provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.NewAppError(domain.ErrCodeAuthIdentityNotFound, fmt.Sprintf("No %s account is linked", provider), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+
+	return nil
+}
+
+// createUser creates a new user in the database
+func (a *authService) createUser(ctx context.Context, userInfo *ProviderUser) (*domain.User, error) {
+	return insertUser(userInfo, func(user *domain.User) error {
+		return a.userRepo.Create(ctx, user)
+	})
+}
+
+// createUserTx creates a new user as part of tx
+func (a *authService) createUserTx(ctx context.Context, tx *sql.Tx, userInfo *ProviderUser) (*domain.User, error) {
+	return insertUser(userInfo, func(user *domain.User) error {
+		return a.userRepo.CreateTx(ctx, tx, user)
+	})
+}
+
+func insertUser(userInfo *ProviderUser, create func(user *domain.User) error) (*domain.User, error) {
+	user := &domain.User{
+		ID:         uuid.New().String(),
+		Name:       userInfo.Name,
+		Email:      userInfo.Email,
+		Username:   userInfo.Username,
+		ProfilePic: userInfo.Picture,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	err := create(user)
+	if errors.Is(err, repository.ErrUsernameTaken) {
+		// Someone already has the provider's username, so make it unique
+		user.Username = fmt.Sprintf("%s_%s", user.Username, user.ID[:8])
+		err = create(user)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return user, nil
 }
 
 func (a *authService) Logout(ctx context.Context, token string) *domain.AppError {
-	err := a.sessionRepo.DeleteByToken(ctx, token)
+	// A request still carrying the token from before a rotation signs out too
+	err := a.sessionRepo.DeleteByToken(ctx, hashToken(token), time.Now().Add(-sessionRotationGrace))
 	if err != nil {
 		slog.Error("Failed to logout", "error", err)
 		return &domain.AppError{
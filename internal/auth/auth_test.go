@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+const testFrontendOrigin = "http://app.test"
+
+// newTestDB creates a database in a temporary directory with every migration applied
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// Search isn't used here, so its migration is skipped when SQLite lacks FTS5
+	_, fts5Err := db.Exec(`SELECT fts5(NULL)`)
+
+	files, err := filepath.Glob("../db/migrations/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("find migrations: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read migration: %v", err)
+		}
+
+		up, _, _ := strings.Cut(string(data), "-- +goose Down")
+		if fts5Err != nil && strings.Contains(up, "USING fts5") {
+			continue
+		}
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("apply %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return db
+}
+
+// testMailer keeps sent emails so tests can follow the links in them
+type testMailer struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (m *testMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+func newTestService(t *testing.T, providers ...Provider) (*authService, *testMailer) {
+	t.Helper()
+
+	mail := &testMailer{}
+	service := NewAuthService(newTestDB(t), mail, []string{testFrontendOrigin}, providers...).(*authService)
+	return service, mail
+}
+
+func assertErrorCode(t *testing.T, err error, code domain.ErrorCode) {
+	t.Helper()
+
+	var domainErr *domain.AppError
+	if !errors.As(err, &domainErr) {
+		t.Fatalf("got error %v, want code %d", err, code)
+	}
+	if domainErr.Code != code {
+		t.Fatalf("got code %d (%s), want %d", domainErr.Code, domainErr.Message, code)
+	}
+}
+
+// fakeGitHub serves GitHub's token endpoint and API, handing out accessToken
+// for code when the PKCE verifier matches the challenge the last login was started with
+type fakeGitHub struct {
+	server      *httptest.Server
+	code        string
+	accessToken string
+	emails      []githubEmail
+
+	mu        sync.Mutex
+	challenge string
+}
+
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	t.Helper()
+
+	f := &fakeGitHub{
+		code:        "auth-code",
+		accessToken: "access-token",
+		emails: []githubEmail{
+			{Email: "octo@example.com", Primary: true, Verified: true},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		f.mu.Lock()
+		challenge := f.challenge
+		f.mu.Unlock()
+		if r.PostForm.Get("code") != f.code || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"bad_verification_code"}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": f.accessToken, "token_type": "bearer"})
+	})
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(w, r) {
+			return
+		}
+		json.NewEncoder(w).Encode(githubUser{ID: 583231, Login: "the-octocat", AvatarURL: "https://avatars.test/583231"})
+	})
+	mux.HandleFunc("GET /user/emails", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(w, r) {
+			return
+		}
+		json.NewEncoder(w).Encode(f.emails)
+	})
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeGitHub) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "Bearer "+f.accessToken {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (f *fakeGitHub) provider() Provider {
+	return NewGitHubProvider("client-id", "client-secret", "http://api.test/auth/github/callback", GitHubEndpoints{
+		AuthURL:  f.server.URL + "/authorize",
+		TokenURL: f.server.URL + "/token",
+		APIURL:   f.server.URL,
+	})
+}
+
+// startLogin begins a login and records the PKCE challenge it sent, returning the state
+func (f *fakeGitHub) startLogin(t *testing.T, service *authService) string {
+	t.Helper()
+
+	redirect, err := service.LoginWithProvider(context.Background(), domain.AuthProviderGitHub, testFrontendOrigin+"/home")
+	if err != nil {
+		t.Fatalf("LoginWithProvider: %v", err)
+	}
+
+	u, err := url.Parse(redirect.URL)
+	if err != nil {
+		t.Fatalf("parse login URL: %v", err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("login URL %q doesn't use an S256 challenge", redirect.URL)
+	}
+	f.mu.Lock()
+	f.challenge = u.Query().Get("code_challenge")
+	f.mu.Unlock()
+
+	return redirect.State
+}
+
+func TestHandleProviderCallbackExchangesCode(t *testing.T) {
+	github := newFakeGitHub(t)
+	service, _ := newTestService(t, github.provider())
+	ctx := context.Background()
+
+	state := github.startLogin(t, service)
+	session, redirectTo, err := service.HandleProviderCallback(ctx, domain.AuthProviderGitHub, github.code, state, domain.ClientInfo{})
+	if err != nil {
+		t.Fatalf("HandleProviderCallback: %v", err)
+	}
+	if redirectTo != testFrontendOrigin+"/home" {
+		t.Errorf("redirect = %q, want the one the login started with", redirectTo)
+	}
+
+	user, err := service.userRepo.FindByID(ctx, session.UserID)
+	if err != nil {
+		t.Fatalf("find user: %v", err)
+	}
+	if user.Email != "octo@example.com" || user.Username != "the_octocat" {
+		t.Errorf("user = %+v, want the GitHub account's email and login", user)
+	}
+
+	identity, err := service.identityRepo.FindByProviderSubject(ctx, domain.AuthProviderGitHub, "583231")
+	if err != nil {
+		t.Fatalf("find identity: %v", err)
+	}
+	if identity.UserID != user.ID {
+		t.Errorf("identity links user %s, want %s", identity.UserID, user.ID)
+	}
+}
+
+func TestHandleProviderCallbackRejectsWrongCode(t *testing.T) {
+	github := newFakeGitHub(t)
+	service, _ := newTestService(t, github.provider())
+
+	state := github.startLogin(t, service)
+	if _, _, err := service.HandleProviderCallback(context.Background(), domain.AuthProviderGitHub, "wrong-code", state, domain.ClientInfo{}); err == nil {
+		t.Fatal("callback with a code the provider rejects succeeded")
+	}
+}
+
+func TestHandleProviderCallbackWithoutVerifiedEmail(t *testing.T) {
+	github := newFakeGitHub(t)
+	github.emails = []githubEmail{
+		{Email: "octo@example.com", Primary: true, Verified: false},
+		{Email: "other@example.com", Primary: false, Verified: true},
+	}
+	service, _ := newTestService(t, github.provider())
+	ctx := context.Background()
+
+	state := github.startLogin(t, service)
+	_, _, err := service.HandleProviderCallback(ctx, domain.AuthProviderGitHub, github.code, state, domain.ClientInfo{})
+	if !errors.Is(err, errNoVerifiedEmail) {
+		t.Fatalf("got error %v, want errNoVerifiedEmail", err)
+	}
+
+	for _, email := range []string{"octo@example.com", "other@example.com"} {
+		if _, err := service.userRepo.FindByEmail(ctx, email); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("user %s was created (err %v)", email, err)
+		}
+	}
+}
+
+func TestHandleProviderCallbackConsumesState(t *testing.T) {
+	github := newFakeGitHub(t)
+	service, _ := newTestService(t, github.provider())
+	ctx := context.Background()
+
+	state := github.startLogin(t, service)
+	if _, _, err := service.HandleProviderCallback(ctx, domain.AuthProviderGitHub, github.code, state, domain.ClientInfo{}); err != nil {
+		t.Fatalf("first callback: %v", err)
+	}
+
+	_, _, err := service.HandleProviderCallback(ctx, domain.AuthProviderGitHub, github.code, state, domain.ClientInfo{})
+	assertErrorCode(t, err, domain.ErrCodeAuthInvalidState)
+}
+
+func TestHandleProviderCallbackRejectsInvalidState(t *testing.T) {
+	github := newFakeGitHub(t)
+	google := NewGoogleProvider("client-id", "client-secret", "http://api.test/auth/google/callback", GoogleEndpoints{})
+	service, _ := newTestService(t, github.provider(), google)
+	ctx := context.Background()
+
+	t.Run("unknown", func(t *testing.T) {
+		_, _, err := service.HandleProviderCallback(ctx, domain.AuthProviderGitHub, github.code, "unknown", domain.ClientInfo{})
+		assertErrorCode(t, err, domain.ErrCodeAuthInvalidState)
+	})
+
+	t.Run("other provider", func(t *testing.T) {
+		state := github.startLogin(t, service)
+		_, _, err := service.HandleProviderCallback(ctx, domain.AuthProviderGoogle, github.code, state, domain.ClientInfo{})
+		assertErrorCode(t, err, domain.ErrCodeAuthInvalidState)
+
+		// The mismatched callback still used the state up
+		_, _, err = service.HandleProviderCallback(ctx, domain.AuthProviderGitHub, github.code, state, domain.ClientInfo{})
+		assertErrorCode(t, err, domain.ErrCodeAuthInvalidState)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		state := github.startLogin(t, service)
+		if _, err := service.db.Exec(`UPDATE oauth_states SET expires_at = 0 WHERE state = ?`, state); err != nil {
+			t.Fatalf("expire state: %v", err)
+		}
+		_, _, err := service.HandleProviderCallback(ctx, domain.AuthProviderGitHub, github.code, state, domain.ClientInfo{})
+		assertErrorCode(t, err, domain.ErrCodeAuthInvalidState)
+	})
+}
+
+func TestHandleProviderCallbackSendsStateVerifier(t *testing.T) {
+	github := newFakeGitHub(t)
+	service, _ := newTestService(t, github.provider())
+	ctx := context.Background()
+
+	// The fake only accepts the verifier of the latest login, so finishing the
+	// first one shows the exchange sends the verifier stored with its own state
+	first := github.startLogin(t, service)
+	github.startLogin(t, service)
+
+	if _, _, err := service.HandleProviderCallback(ctx, domain.AuthProviderGitHub, github.code, first, domain.ClientInfo{}); err == nil {
+		t.Fatal("exchange succeeded with another login's verifier")
+	}
+}
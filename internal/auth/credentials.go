@@ -0,0 +1,359 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+const (
+	// Consecutive failed logins before the account is locked
+	maxFailedLogins = 5
+	lockoutDuration = 15 * time.Minute
+
+	emailTokenBytes            = 32
+	emailVerificationTokenTTL  = 24 * time.Hour
+	passwordResetTokenTTL      = time.Hour
+	minUsernameLength          = 3
+	maxUsernameFromEmailLength = 20
+)
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+func (a *authService) Register(ctx context.Context, req domain.RegisterReq) (*domain.User, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	_, err := a.userRepo.FindByEmail(ctx, req.Email)
+	if err == nil {
+		return nil, domain.NewAppError(domain.ErrCodeAuthEmailTaken, "An account with this email already exists", nil)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+
+	passwordHash, err := hashPassword(req.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// Without its credential the account couldn't be signed into or registered again
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	user, err := a.createUserTx(ctx, tx, &ProviderUser{
+		Name:     req.Name,
+		Email:    req.Email,
+		Username: usernameFromEmail(req.Email),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	credential := &domain.Credential{
+		UserID:       user.ID,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := a.credentialRepo.CreateTx(ctx, tx, credential); err != nil {
+		return nil, fmt.Errorf("failed to create credential: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit registration: %w", err)
+	}
+
+	// The account exists either way; a lost email can be sent again
+	if err := a.sendVerificationEmail(ctx, user); err != nil {
+		slog.Error("Failed to send verification email", "userId", user.ID, "error", err)
+	}
+
+	return user, nil
+}
+
+func (a *authService) LoginWithPassword(ctx context.Context, req domain.PasswordLoginReq, client domain.ClientInfo) (*domain.Session, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	invalidCredentials := domain.NewAppError(domain.ErrCodeAuthInvalidCredentials, "Invalid email or password", nil)
+
+	user, credential, err := a.findCredential(ctx, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		// Spend the same time hashing as a real login, so unknown emails can't be told apart
+		verifyPassword(req.Password, dummyPasswordHash)
+		return nil, invalidCredentials
+	}
+
+	if credential.LockedUntil != nil && credential.LockedUntil.After(time.Now()) {
+		return nil, domain.NewAppError(domain.ErrCodeAuthAccountLocked, "Too many failed logins, try again later", nil)
+	}
+
+	ok, err := verifyPassword(req.Password, credential.PasswordHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify password: %w", err)
+	}
+	if !ok {
+		locked, err := a.credentialRepo.RecordFailure(ctx, user.ID, maxFailedLogins, time.Now().Add(lockoutDuration))
+		if err != nil {
+			return nil, fmt.Errorf("failed to record failed login: %w", err)
+		}
+		if locked {
+			slog.Warn("Account locked after failed logins", "userId", user.ID)
+			return nil, domain.NewAppError(domain.ErrCodeAuthAccountLocked, "Too many failed logins, try again later", nil)
+		}
+		return nil, invalidCredentials
+	}
+
+	if credential.FailedAttempts > 0 || credential.LockedUntil != nil {
+		if err := a.credentialRepo.ResetFailures(ctx, user.ID); err != nil {
+			return nil, fmt.Errorf("failed to reset failed logins: %w", err)
+		}
+	}
+
+	if credential.EmailVerifiedAt == nil {
+		return nil, domain.NewAppError(domain.ErrCodeAuthEmailNotVerified, "Verify your email address before signing in", nil)
+	}
+
+	return a.createSession(ctx, user.ID, domain.AuthProviderPassword, client)
+}
+
+func (a *authService) VerifyEmail(ctx context.Context, req domain.VerifyEmailReq) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	token, err := a.consumeToken(ctx, req.Token, domain.AuthTokenEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	if err := a.credentialRepo.MarkEmailVerified(ctx, token.UserID); err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	return nil
+}
+
+func (a *authService) ResendVerification(ctx context.Context, req domain.EmailReq) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	// Succeeds whether or not the email has an account, so it can't be used to look them up
+	user, credential, err := a.findCredential(ctx, req.Email)
+	if err != nil || credential == nil || credential.EmailVerifiedAt != nil {
+		return err
+	}
+
+	if err := a.sendVerificationEmail(ctx, user); err != nil {
+		slog.Error("Failed to send verification email", "userId", user.ID, "error", err)
+	}
+
+	return nil
+}
+
+func (a *authService) RequestPasswordReset(ctx context.Context, req domain.EmailReq) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	user, err := a.userRepo.FindByEmail(ctx, req.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+
+	// OAuth users have no credential yet, but may reset to add a password
+	token, err := a.issueToken(ctx, user.ID, domain.AuthTokenPasswordReset, passwordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Reset your password within the next hour:\n\n%s", a.frontendURL("reset-password", token))
+	if err := a.mailer.Send(ctx, user.Email, "Reset your Tubbym password", body); err != nil {
+		slog.Error("Failed to send password reset email", "userId", user.ID, "error", err)
+	}
+
+	return nil
+}
+
+func (a *authService) ResetPassword(ctx context.Context, req domain.ResetPasswordReq) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	passwordHash, err := hashPassword(req.Password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	token, err := a.consumeToken(ctx, req.Token, domain.AuthTokenPasswordReset)
+	if err != nil {
+		return err
+	}
+
+	if err := a.credentialRepo.SetPassword(ctx, token.UserID, passwordHash); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+
+	// Receiving the reset email proves the user owns the address
+	if err := a.credentialRepo.MarkEmailVerified(ctx, token.UserID); err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	if err := a.sessionRepo.DeleteByUserID(ctx, token.UserID, ""); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
+
+func (a *authService) ChangePassword(ctx context.Context, session *domain.Session, req domain.ChangePasswordReq) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	credential, err := a.credentialRepo.FindByUserID(ctx, session.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.NewAppError(domain.ErrCodeAuthInvalidCredentials, "This account has no password; use password reset to set one", nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query credential: %w", err)
+	}
+
+	ok, err := verifyPassword(req.CurrentPassword, credential.PasswordHash)
+	if err != nil {
+		return fmt.Errorf("failed to verify password: %w", err)
+	}
+	if !ok {
+		return domain.NewAppError(domain.ErrCodeAuthInvalidCredentials, "Current password is incorrect", nil)
+	}
+
+	passwordHash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := a.credentialRepo.SetPassword(ctx, session.UserID, passwordHash); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+
+	// Sign out everywhere else, keeping the session that made the change
+	if err := a.sessionRepo.DeleteByUserID(ctx, session.UserID, session.ID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
+
+// findCredential looks up the user with email and their password credential,
+// returning a nil credential when either doesn't exist
+func (a *authService) findCredential(ctx context.Context, email string) (*domain.User, *domain.Credential, error) {
+	user, err := a.userRepo.FindByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query user: %w", err)
+	}
+
+	credential, err := a.credentialRepo.FindByUserID(ctx, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query credential: %w", err)
+	}
+
+	return user, credential, nil
+}
+
+func (a *authService) sendVerificationEmail(ctx context.Context, user *domain.User) error {
+	token, err := a.issueToken(ctx, user.ID, domain.AuthTokenEmailVerification, emailVerificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Confirm your email address to finish signing up:\n\n%s", a.frontendURL("verify-email", token))
+	return a.mailer.Send(ctx, user.Email, "Verify your Tubbym email", body)
+}
+
+// issueToken creates a single use token for the user, replacing any earlier
+// one with the same purpose. Only its hash is stored.
+func (a *authService) issueToken(ctx context.Context, userID string, purpose domain.AuthTokenPurpose, ttl time.Duration) (string, error) {
+	b := make([]byte, emailTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+
+	authToken := &domain.AuthToken{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+	if err := a.authTokenRepo.Create(ctx, authToken); err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (a *authService) consumeToken(ctx context.Context, token string, purpose domain.AuthTokenPurpose) (*domain.AuthToken, error) {
+	authToken, err := a.authTokenRepo.Consume(ctx, hashToken(token), purpose)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.NewAppError(domain.ErrCodeAuthInvalidToken, "Invalid or expired token", nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume token: %w", err)
+	}
+	return authToken, nil
+}
+
+// frontendURL builds a link to a page of the default frontend carrying token
+func (a *authService) frontendURL(page string, token string) string {
+	return a.DefaultRedirect() + page + "?token=" + url.QueryEscape(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// usernameFromEmail derives a starting username from the local part of email;
+// createUser makes it unique if it is taken
+func usernameFromEmail(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	username := strings.Trim(usernameInvalidChars.ReplaceAllString(local, "_"), "_")
+	if len(username) > maxUsernameFromEmailLength {
+		username = username[:maxUsernameFromEmailLength]
+	}
+	for len(username) < minUsernameLength {
+		username += "_"
+	}
+	return username
+}
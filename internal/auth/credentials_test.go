@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+const (
+	testEmail    = "ada@example.com"
+	testPassword = "correct horse battery staple"
+)
+
+var mailedTokenPattern = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+// lastToken returns the token in the link of the most recent email
+func (m *testMailer) lastToken(t *testing.T) string {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.bodies) == 0 {
+		t.Fatal("no email was sent")
+	}
+	match := mailedTokenPattern.FindStringSubmatch(m.bodies[len(m.bodies)-1])
+	if match == nil {
+		t.Fatalf("no token in email %q", m.bodies[len(m.bodies)-1])
+	}
+	return match[1]
+}
+
+// registerVerified registers a password account and verifies its email
+func registerVerified(t *testing.T, service *authService, mail *testMailer) *domain.User {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := service.Register(ctx, domain.RegisterReq{Name: "Ada", Email: testEmail, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := service.VerifyEmail(ctx, domain.VerifyEmailReq{Token: mail.lastToken(t)}); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	return user
+}
+
+func TestLoginWithPasswordLocksOut(t *testing.T) {
+	service, mail := newTestService(t)
+	registerVerified(t, service, mail)
+	ctx := context.Background()
+	wrong := domain.PasswordLoginReq{Email: testEmail, Password: "not the password"}
+
+	for i := 1; i < maxFailedLogins; i++ {
+		_, err := service.LoginWithPassword(ctx, wrong, domain.ClientInfo{})
+		assertErrorCode(t, err, domain.ErrCodeAuthInvalidCredentials)
+	}
+
+	_, err := service.LoginWithPassword(ctx, wrong, domain.ClientInfo{})
+	assertErrorCode(t, err, domain.ErrCodeAuthAccountLocked)
+
+	// Even the right password is refused until the lockout ends
+	_, err = service.LoginWithPassword(ctx, domain.PasswordLoginReq{Email: testEmail, Password: testPassword}, domain.ClientInfo{})
+	assertErrorCode(t, err, domain.ErrCodeAuthAccountLocked)
+}
+
+func TestLoginWithPasswordResetsFailures(t *testing.T) {
+	service, mail := newTestService(t)
+	registerVerified(t, service, mail)
+	ctx := context.Background()
+	wrong := domain.PasswordLoginReq{Email: testEmail, Password: "not the password"}
+	right := domain.PasswordLoginReq{Email: testEmail, Password: testPassword}
+
+	for i := 1; i < maxFailedLogins; i++ {
+		service.LoginWithPassword(ctx, wrong, domain.ClientInfo{})
+	}
+	if _, err := service.LoginWithPassword(ctx, right, domain.ClientInfo{}); err != nil {
+		t.Fatalf("login with the right password: %v", err)
+	}
+
+	// The count started over, so one more failure doesn't lock the account
+	_, err := service.LoginWithPassword(ctx, wrong, domain.ClientInfo{})
+	assertErrorCode(t, err, domain.ErrCodeAuthInvalidCredentials)
+}
+
+func TestVerifyEmailTokenIsSingleUse(t *testing.T) {
+	service, mail := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := service.Register(ctx, domain.RegisterReq{Name: "Ada", Email: testEmail, Password: testPassword}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	token := mail.lastToken(t)
+
+	if err := service.VerifyEmail(ctx, domain.VerifyEmailReq{Token: token}); err != nil {
+		t.Fatalf("first VerifyEmail: %v", err)
+	}
+	err := service.VerifyEmail(ctx, domain.VerifyEmailReq{Token: token})
+	assertErrorCode(t, err, domain.ErrCodeAuthInvalidToken)
+}
+
+func TestResetPasswordTokenIsSingleUse(t *testing.T) {
+	service, mail := newTestService(t)
+	registerVerified(t, service, mail)
+	ctx := context.Background()
+
+	if err := service.RequestPasswordReset(ctx, domain.EmailReq{Email: testEmail}); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := mail.lastToken(t)
+
+	if err := service.ResetPassword(ctx, domain.ResetPasswordReq{Token: token, Password: "a brand new password"}); err != nil {
+		t.Fatalf("first ResetPassword: %v", err)
+	}
+	err := service.ResetPassword(ctx, domain.ResetPasswordReq{Token: token, Password: "yet another password"})
+	assertErrorCode(t, err, domain.ErrCodeAuthInvalidToken)
+
+	if _, err := service.LoginWithPassword(ctx, domain.PasswordLoginReq{Email: testEmail, Password: "a brand new password"}, domain.ClientInfo{}); err != nil {
+		t.Fatalf("login with the reset password: %v", err)
+	}
+}
+
+func TestResetPasswordTokenOnlyServesItsPurpose(t *testing.T) {
+	service, mail := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := service.Register(ctx, domain.RegisterReq{Name: "Ada", Email: testEmail, Password: testPassword}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	// A verification token can't be used to reset the password
+	err := service.ResetPassword(ctx, domain.ResetPasswordReq{Token: mail.lastToken(t), Password: "a brand new password"})
+	assertErrorCode(t, err, domain.ErrCodeAuthInvalidToken)
+}
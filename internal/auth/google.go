@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const googleUserInfoURL = "https://www.googleapis.com/oauth2/v3/userinfo"
+
+// GoogleEndpoints overrides Google's OAuth endpoints; empty fields use the real ones
+type GoogleEndpoints struct {
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+}
+
+type googleProvider struct {
+	config      *oauth2.Config
+	userInfoURL string
+}
+
+func NewGoogleProvider(clientID, clientSecret, redirectURL string, endpoints GoogleEndpoints) Provider {
+	endpoint := google.Endpoint
+	if endpoints.AuthURL != "" {
+		endpoint.AuthURL = endpoints.AuthURL
+	}
+	if endpoints.TokenURL != "" {
+		endpoint.TokenURL = endpoints.TokenURL
+	}
+
+	userInfoURL := googleUserInfoURL
+	if endpoints.UserInfoURL != "" {
+		userInfoURL = endpoints.UserInfoURL
+	}
+
+	return &googleProvider{
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     endpoint,
+			Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
+		},
+		userInfoURL: userInfoURL,
+	}
+}
+
+func (p *googleProvider) Name() domain.AuthProvider {
+	return domain.AuthProviderGoogle
+}
+
+func (p *googleProvider) Config() *oauth2.Config {
+	return p.config
+}
+
+// googleUserInfo represents the user information from Google OAuth
+type googleUserInfo struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+func (p *googleProvider) FetchUser(ctx context.Context, client *http.Client) (*ProviderUser, error) {
+	var userInfo googleUserInfo
+	if err := getJSON(ctx, client, p.userInfoURL, nil, &userInfo); err != nil {
+		return nil, err
+	}
+
+	// Accounts are matched by email, so it must be one Google has verified
+	if !userInfo.EmailVerified {
+		return nil, errNoVerifiedEmail
+	}
+
+	return &ProviderUser{
+		Subject:  userInfo.Sub,
+		Name:     userInfo.Name,
+		Email:    userInfo.Email,
+		Username: userInfo.Sub, // Use Google's sub as username for now
+		Picture:  userInfo.Picture,
+	}, nil
+}
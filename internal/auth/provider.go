@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"golang.org/x/oauth2"
+)
+
+var errNoVerifiedEmail = errors.New("provider account has no verified email")
+
+// ProviderUser is the account information an OAuth provider returns for the signed-in user
+type ProviderUser struct {
+	// Stable ID of the account at the provider
+	Subject  string
+	Name     string
+	Email    string
+	Username string
+	Picture  string
+}
+
+// Provider is an OAuth login provider
+type Provider interface {
+	Name() domain.AuthProvider
+	Config() *oauth2.Config
+	// FetchUser loads the signed-in user with client, which is authorized with their access token
+	FetchUser(ctx context.Context, client *http.Client) (*ProviderUser, error)
+}
+
+// NewProvidersFromEnv creates the providers that have credentials configured
+// in the environment. Endpoints can be overridden to test against a fake
+// OAuth server. Callbacks are served from baseURL.
+func NewProvidersFromEnv(baseURL string) []Provider {
+	var providers []Provider
+
+	if clientID, clientSecret := os.Getenv("GOOGLE_CLIENT_ID"), os.Getenv("GOOGLE_CLIENT_SECRET"); clientID != "" && clientSecret != "" {
+		providers = append(providers, NewGoogleProvider(clientID, clientSecret, baseURL+"/auth/google/callback", GoogleEndpoints{
+			AuthURL:     os.Getenv("GOOGLE_AUTH_URL"),
+			TokenURL:    os.Getenv("GOOGLE_TOKEN_URL"),
+			UserInfoURL: os.Getenv("GOOGLE_USERINFO_URL"),
+		}))
+	}
+
+	if clientID, clientSecret := os.Getenv("GITHUB_CLIENT_ID"), os.Getenv("GITHUB_CLIENT_SECRET"); clientID != "" && clientSecret != "" {
+		providers = append(providers, NewGitHubProvider(clientID, clientSecret, baseURL+"/auth/github/callback", GitHubEndpoints{
+			AuthURL:  os.Getenv("GITHUB_AUTH_URL"),
+			TokenURL: os.Getenv("GITHUB_TOKEN_URL"),
+			APIURL:   os.Getenv("GITHUB_API_URL"),
+		}))
+	}
+
+	return providers
+}
+
+// getJSON fetches url with client and decodes the JSON response into v
+func getJSON(ctx context.Context, client *http.Client, url string, header http.Header, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
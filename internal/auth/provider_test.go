@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGoogleFetchUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		userInfo googleUserInfo
+		want     *ProviderUser
+		wantErr  error
+	}{
+		{
+			name: "verified email",
+			userInfo: googleUserInfo{
+				Sub: "109876543210987654321", Name: "Ada", Picture: "https://pics.test/ada",
+				Email: "ada@example.com", EmailVerified: true,
+			},
+			want: &ProviderUser{
+				Subject: "109876543210987654321", Name: "Ada", Email: "ada@example.com",
+				Username: "109876543210987654321", Picture: "https://pics.test/ada",
+			},
+		},
+		{
+			name:     "unverified email",
+			userInfo: googleUserInfo{Sub: "1", Email: "ada@example.com", EmailVerified: false},
+			wantErr:  errNoVerifiedEmail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/userinfo" {
+					http.NotFound(w, r)
+					return
+				}
+				json.NewEncoder(w).Encode(tt.userInfo)
+			}))
+			defer server.Close()
+
+			provider := NewGoogleProvider("id", "secret", "http://api.test/callback", GoogleEndpoints{UserInfoURL: server.URL + "/userinfo"})
+			got, err := provider.FetchUser(context.Background(), server.Client())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHubFetchUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    githubUser
+		emails  []githubEmail
+		want    *ProviderUser
+		wantErr error
+	}{
+		{
+			name: "primary verified email",
+			user: githubUser{ID: 42, Login: "mona-lisa", Name: "Mona", AvatarURL: "https://avatars.test/42"},
+			emails: []githubEmail{
+				{Email: "old@example.com", Primary: false, Verified: true},
+				{Email: "mona@example.com", Primary: true, Verified: true},
+			},
+			want: &ProviderUser{
+				Subject: "42", Name: "Mona", Email: "mona@example.com",
+				Username: "mona_lisa", Picture: "https://avatars.test/42",
+			},
+		},
+		{
+			name:   "name falls back to login",
+			user:   githubUser{ID: 7, Login: "octocat"},
+			emails: []githubEmail{{Email: "octo@example.com", Primary: true, Verified: true}},
+			want:   &ProviderUser{Subject: "7", Name: "octocat", Email: "octo@example.com", Username: "octocat"},
+		},
+		{
+			name: "no primary verified email",
+			user: githubUser{ID: 42, Login: "mona"},
+			emails: []githubEmail{
+				{Email: "mona@example.com", Primary: true, Verified: false},
+				{Email: "other@example.com", Primary: false, Verified: true},
+			},
+			wantErr: errNoVerifiedEmail,
+		},
+		{
+			name:    "no emails",
+			user:    githubUser{ID: 42, Login: "mona"},
+			emails:  []githubEmail{},
+			wantErr: errNoVerifiedEmail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(tt.user)
+			})
+			mux.HandleFunc("GET /user/emails", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(tt.emails)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			provider := NewGitHubProvider("id", "secret", "http://api.test/callback", GitHubEndpoints{APIURL: server.URL})
+			got, err := provider.FetchUser(context.Background(), server.Client())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchUserFailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	providers := []Provider{
+		NewGoogleProvider("id", "secret", "http://api.test/callback", GoogleEndpoints{UserInfoURL: server.URL}),
+		NewGitHubProvider("id", "secret", "http://api.test/callback", GitHubEndpoints{APIURL: server.URL}),
+	}
+	for _, provider := range providers {
+		if _, err := provider.FetchUser(context.Background(), server.Client()); err == nil {
+			t.Errorf("%s: FetchUser succeeded on a 401", provider.Name())
+		}
+	}
+}
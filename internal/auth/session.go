@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+func (a *authService) createSession(ctx context.Context, userID string, provider domain.AuthProvider, client domain.ClientInfo) (*domain.Session, error) {
+	token, err := a.generateSecureToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	now := time.Now()
+	session := &domain.Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Token:      token,
+		TokenHash:  hashToken(token),
+		Provider:   provider,
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+		LastSeenAt: now,
+		ExpiredAt:  now.Add(sessionDuration),
+		CreatedAt:  now,
+	}
+
+	if err := a.sessionRepo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return session, nil
+}
+
+func (a *authService) ValidateSession(token string) (*domain.ValidateSessionDTO, *domain.AppError) {
+	tokenHash := hashToken(token)
+	dto, err := a.sessionRepo.FindByTokenWithUser(context.Background(), tokenHash, time.Now().Add(-sessionRotationGrace))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &domain.AppError{
+				Code:    domain.ErrCodeAuthInvalidSession,
+				Message: "Invalid or expired session",
+				Err:     err,
+			}
+		}
+		slog.Error("Failed to validate session", "error", err)
+		return nil, &domain.AppError{
+			Code:    domain.ErrCodeAuthInvalidSession,
+			Message: "Session validation failed",
+			Err:     err,
+		}
+	}
+
+	// Keep the hash the request presented, which may be the one the session was
+	// just rotated away from, so rotating again can tell it's out of date
+	dto.Session.TokenHash = tokenHash
+
+	return dto, nil
+}
+
+func (a *authService) RefreshSession(ctx context.Context, session *domain.Session, client domain.ClientInfo, rotate bool) (string, error) {
+	now := time.Now()
+
+	// Only write back once in a while, rather than on every request
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval || client != sessionClient(session) {
+		expiredAt := now.Add(sessionDuration)
+		if maxExpiry := session.CreatedAt.Add(SessionMaxLifetime); expiredAt.After(maxExpiry) {
+			expiredAt = maxExpiry
+		}
+
+		if err := a.sessionRepo.Touch(ctx, session.ID, client, now, expiredAt); err != nil {
+			return "", fmt.Errorf("failed to touch session: %w", err)
+		}
+	}
+
+	issuedAt := session.CreatedAt
+	if session.RotatedAt != nil {
+		issuedAt = *session.RotatedAt
+	}
+	if !rotate || now.Sub(issuedAt) < sessionRotationInterval {
+		return "", nil
+	}
+
+	rotated, err := a.RotateSession(ctx, session)
+	if err != nil {
+		// A concurrent request got there first and set its own cookie
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeAuthSessionRotated {
+			return "", nil
+		}
+		return "", err
+	}
+	return rotated.Token, nil
+}
+
+func (a *authService) RotateSession(ctx context.Context, session *domain.Session) (*domain.Session, error) {
+	token, err := a.generateSecureToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	err = a.sessionRepo.Rotate(ctx, session.ID, session.TokenHash, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.NewAppError(domain.ErrCodeAuthSessionRotated, "Session was already rotated", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate session: %w", err)
+	}
+
+	rotated := *session
+	rotated.Token = token
+	rotated.TokenHash = hashToken(token)
+	now := time.Now()
+	rotated.RotatedAt = &now
+
+	return &rotated, nil
+}
+
+func (a *authService) ListSessions(ctx context.Context, current *domain.Session) ([]domain.Session, error) {
+	sessions, err := a.sessionRepo.ListByUserID(ctx, current.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current.ID
+	}
+
+	return sessions, nil
+}
+
+func (a *authService) RevokeSession(ctx context.Context, userID string, sessionID string) error {
+	err := a.sessionRepo.DeleteByID(ctx, userID, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.NewAppError(domain.ErrCodeAuthSessionNotFound, "Session not found", nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+func (a *authService) RevokeOtherSessions(ctx context.Context, current *domain.Session) error {
+	if err := a.sessionRepo.DeleteByUserID(ctx, current.UserID, current.ID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+func sessionClient(session *domain.Session) domain.ClientInfo {
+	return domain.ClientInfo{UserAgent: session.UserAgent, IPAddress: session.IPAddress}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// newTestSession signs a new user in, returning the session's token
+func newTestSession(t *testing.T, service *authService) string {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := service.createUser(ctx, &ProviderUser{Name: "Ada", Email: testEmail, Username: "ada"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	session, err := service.createSession(ctx, user.ID, domain.AuthProviderGitHub, domain.ClientInfo{})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	return session.Token
+}
+
+func validate(t *testing.T, service *authService, token string) *domain.Session {
+	t.Helper()
+
+	dto, appErr := service.ValidateSession(token)
+	if appErr != nil {
+		t.Fatalf("ValidateSession: %v", appErr)
+	}
+	return &dto.Session
+}
+
+func TestRotateSessionOnlyOnce(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	token := newTestSession(t, service)
+
+	// Two requests authenticated with the same token both try to rotate it
+	first := validate(t, service, token)
+	second := validate(t, service, token)
+
+	rotated, err := service.RotateSession(ctx, first)
+	if err != nil {
+		t.Fatalf("first RotateSession: %v", err)
+	}
+
+	_, err = service.RotateSession(ctx, second)
+	assertErrorCode(t, err, domain.ErrCodeAuthSessionRotated)
+
+	// The winner's token is the current one, and the old one lasts out its grace period
+	if got := validate(t, service, rotated.Token); got.ID != first.ID {
+		t.Errorf("rotated token signs in session %s, want %s", got.ID, first.ID)
+	}
+	validate(t, service, token)
+
+	// A request still using the old token can't rotate the session again
+	_, err = service.RotateSession(ctx, validate(t, service, token))
+	assertErrorCode(t, err, domain.ErrCodeAuthSessionRotated)
+}
+
+func TestRefreshSessionRotatesDueCookieOnce(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	token := newTestSession(t, service)
+
+	// Make the token due for rotation
+	issuedAt := time.Now().Add(-sessionRotationInterval - time.Minute).Unix()
+	if _, err := service.db.Exec(`UPDATE sessions SET created_at = ?, last_seen_at = ?`, issuedAt, issuedAt); err != nil {
+		t.Fatalf("age session: %v", err)
+	}
+
+	first := validate(t, service, token)
+	second := validate(t, service, token)
+
+	newToken, err := service.RefreshSession(ctx, first, domain.ClientInfo{}, true)
+	if err != nil || newToken == "" {
+		t.Fatalf("first RefreshSession = %q, %v; want a new token", newToken, err)
+	}
+
+	// The concurrent request leaves the cookie the first one set alone
+	newToken, err = service.RefreshSession(ctx, second, domain.ClientInfo{}, true)
+	if err != nil || newToken != "" {
+		t.Fatalf("second RefreshSession = %q, %v; want no new token", newToken, err)
+	}
+}
+
+func TestRefreshSessionKeepsRecentToken(t *testing.T) {
+	service, _ := newTestService(t)
+	token := newTestSession(t, service)
+
+	newToken, err := service.RefreshSession(context.Background(), validate(t, service, token), domain.ClientInfo{}, true)
+	if err != nil || newToken != "" {
+		t.Fatalf("RefreshSession = %q, %v; want no new token for a fresh session", newToken, err)
+	}
+}
+
+func TestLogoutWithPreviousTokenEndsSession(t *testing.T) {
+	service, _ := newTestService(t)
+	ctx := context.Background()
+	token := newTestSession(t, service)
+
+	rotated, err := service.RotateSession(ctx, validate(t, service, token))
+	if err != nil {
+		t.Fatalf("RotateSession: %v", err)
+	}
+
+	// A tab that hasn't picked up the rotated cookie yet signs out
+	if appErr := service.Logout(ctx, token); appErr != nil {
+		t.Fatalf("Logout: %v", appErr)
+	}
+
+	for name, token := range map[string]string{"previous": token, "rotated": rotated.Token} {
+		if _, appErr := service.ValidateSession(token); appErr == nil {
+			t.Errorf("%s token still signs in after logout", name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/thantko20/tubbym-backend/internal/transcoder"
+)
+
+const (
+	StorageDriverS3    = "s3"
+	StorageDriverLocal = "local"
+
+	MailerDriverLog  = "log"
+	MailerDriverSMTP = "smtp"
+)
+
+type Config struct {
+	// Development mode; emails sent by the log mailer are logged in full
+	DevMode bool
+
+	// Address the HTTP server listens on
+	Addr string
+	// Public URL of this API, used to build URLs served by the API itself
+	PublicBaseURL string
+	// Base URL processed videos are streamed from
+	StreamingBaseURL string
+	// Origins of the web frontends logins may redirect back to; the first is the default
+	FrontendOrigins []string
+
+	StorageDriver string
+	S3Bucket      string
+	// Directory backing the local storage driver
+	LocalStorageDir string
+	// Secret used to sign local storage upload URLs
+	StorageSigningSecret string
+
+	// Shared secret storage event notifications must present; the ingest
+	// endpoint is disabled when empty
+	IngestToken string
+
+	MailerDriver string
+	// SMTP server (host:port) and account the smtp mailer sends through
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	// Address emails are sent from
+	MailFrom string
+
+	// Email of a user given the admin role at startup, once they have signed up
+	AdminBootstrapEmail string
+
+	// How long deleted videos can still be restored before they are purged
+	VideoRetention time.Duration
+	// How often deleted videos are purged; purging is disabled when zero
+	VideoReaperInterval time.Duration
+	// Only log what would be purged instead of removing anything
+	VideoReaperDryRun bool
+
+	// Number of concurrent video processing workers
+	JobWorkers int
+	// Renditions every video is transcoded into
+	TranscodeLadder []transcoder.Variant
+}
+
+// Load reads the configuration from the environment, loading a .env file first if present
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil {
+		slog.Warn("No .env file found, using system environment variables")
+	}
+
+	cfg := &Config{
+		DevMode:              getEnvBool("DEV_MODE", false),
+		Addr:                 getEnv("ADDR", ":8080"),
+		PublicBaseURL:        strings.TrimSuffix(getEnv("PUBLIC_BASE_URL", "http://localhost:8080"), "/"),
+		StorageDriver:        getEnv("STORAGE_DRIVER", StorageDriverS3),
+		S3Bucket:             getEnv("S3_BUCKET", "tubbym-test"),
+		LocalStorageDir:      getEnv("LOCAL_STORAGE_DIR", "./data/storage"),
+		StorageSigningSecret: os.Getenv("STORAGE_SIGNING_SECRET"),
+		JobWorkers:           getEnvInt("JOB_WORKERS", 1),
+		IngestToken:          os.Getenv("INGEST_TOKEN"),
+		MailerDriver:         getEnv("MAILER_DRIVER", MailerDriverLog),
+		SMTPAddr:             os.Getenv("SMTP_ADDR"),
+		SMTPUsername:         os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:         os.Getenv("SMTP_PASSWORD"),
+		MailFrom:             os.Getenv("MAIL_FROM"),
+		AdminBootstrapEmail:  strings.TrimSpace(os.Getenv("ADMIN_BOOTSTRAP_EMAIL")),
+		VideoRetention:       getEnvDuration("VIDEO_RETENTION", 30*24*time.Hour),
+		VideoReaperInterval:  getEnvDuration("VIDEO_REAPER_INTERVAL", time.Hour),
+		VideoReaperDryRun:    getEnvBool("VIDEO_REAPER_DRY_RUN", false),
+	}
+
+	defaultStreamingURL := "https://d29kwr3nijxedo.cloudfront.net"
+	if cfg.StorageDriver == StorageDriverLocal {
+		// The local driver serves processed videos from the API itself
+		defaultStreamingURL = cfg.PublicBaseURL + "/storage/files/processed-videos"
+	}
+	cfg.StreamingBaseURL = strings.TrimSuffix(getEnv("STREAMING_BASE_URL", defaultStreamingURL), "/")
+
+	for _, origin := range strings.Split(getEnv("FRONTEND_ORIGINS", "http://localhost:3000"), ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			cfg.FrontendOrigins = append(cfg.FrontendOrigins, strings.ToLower(origin))
+		}
+	}
+
+	cfg.TranscodeLadder = transcoder.DefaultLadder
+	if path := os.Getenv("TRANSCODE_LADDER_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read transcode ladder: %w", err)
+		}
+		if cfg.TranscodeLadder, err = transcoder.ParseLadder(data); err != nil {
+			return nil, fmt.Errorf("failed to parse transcode ladder %s: %w", path, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
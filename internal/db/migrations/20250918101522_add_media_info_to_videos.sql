@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+ALTER TABLE videos ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN frame_rate REAL NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN video_codec TEXT NOT NULL DEFAULT '';
+ALTER TABLE videos ADD COLUMN rotation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN audio_codec TEXT NOT NULL DEFAULT '';
+ALTER TABLE videos ADD COLUMN audio_channels INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+ALTER TABLE videos DROP COLUMN audio_channels;
+ALTER TABLE videos DROP COLUMN audio_codec;
+ALTER TABLE videos DROP COLUMN rotation;
+ALTER TABLE videos DROP COLUMN video_codec;
+ALTER TABLE videos DROP COLUMN frame_rate;
+ALTER TABLE videos DROP COLUMN height;
+ALTER TABLE videos DROP COLUMN width;
+
+-- +goose StatementEnd
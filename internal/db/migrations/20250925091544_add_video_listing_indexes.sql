@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+CREATE INDEX idx_videos_created_at ON videos (created_at, id);
+CREATE INDEX idx_videos_views ON videos (views, id);
+CREATE INDEX idx_videos_title ON videos (title, id);
+CREATE INDEX idx_videos_status ON videos (status);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+DROP INDEX IF EXISTS idx_videos_status;
+DROP INDEX IF EXISTS idx_videos_title;
+DROP INDEX IF EXISTS idx_videos_views;
+DROP INDEX IF EXISTS idx_videos_created_at;
+
+-- +goose StatementEnd
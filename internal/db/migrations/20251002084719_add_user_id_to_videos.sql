@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Videos uploaded before ownership existed keep a NULL owner
+ALTER TABLE videos ADD COLUMN user_id TEXT REFERENCES users(id);
+CREATE INDEX idx_videos_user_id ON videos (user_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+DROP INDEX IF EXISTS idx_videos_user_id;
+ALTER TABLE videos DROP COLUMN user_id;
+
+-- +goose StatementEnd
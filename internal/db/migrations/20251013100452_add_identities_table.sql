@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Provider accounts users sign in with; a user links at most one account per provider
+CREATE TABLE identities (
+  id TEXT PRIMARY KEY,
+  user_id TEXT NOT NULL,
+  provider TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  email TEXT NOT NULL,
+  created_at INTEGER NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  UNIQUE (provider, subject),
+  UNIQUE (user_id, provider)
+);
+
+-- Set when the OAuth flow links a provider to a signed-in user instead of logging in
+ALTER TABLE oauth_states ADD COLUMN link_user_id TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+ALTER TABLE oauth_states DROP COLUMN link_user_id;
+DROP TABLE IF EXISTS identities;
+
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Sessions now store a SHA-256 hash of their token. Raw tokens can't be
+-- hashed here, so every existing session ends and users sign in again.
+DELETE FROM sessions;
+
+ALTER TABLE sessions RENAME COLUMN token TO token_hash;
+-- The token replaced by the last rotation stays valid briefly for requests already in flight
+ALTER TABLE sessions ADD COLUMN previous_token_hash TEXT;
+ALTER TABLE sessions ADD COLUMN rotated_at INTEGER;
+ALTER TABLE sessions ADD COLUMN last_seen_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX idx_sessions_token_hash ON sessions (token_hash);
+CREATE INDEX idx_sessions_previous_token_hash ON sessions (previous_token_hash);
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+DELETE FROM sessions;
+
+DROP INDEX IF EXISTS idx_sessions_user_id;
+DROP INDEX IF EXISTS idx_sessions_previous_token_hash;
+DROP INDEX IF EXISTS idx_sessions_token_hash;
+
+ALTER TABLE sessions DROP COLUMN ip_address;
+ALTER TABLE sessions DROP COLUMN user_agent;
+ALTER TABLE sessions DROP COLUMN last_seen_at;
+ALTER TABLE sessions DROP COLUMN rotated_at;
+ALTER TABLE sessions DROP COLUMN previous_token_hash;
+ALTER TABLE sessions RENAME COLUMN token_hash TO token;
+
+-- +goose StatementEnd
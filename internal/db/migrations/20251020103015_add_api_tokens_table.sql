@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Personal access tokens for scripts; only a SHA-256 hash of the token is kept
+CREATE TABLE api_tokens (
+  id TEXT PRIMARY KEY,
+  user_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  -- Start of the token, shown so users can tell their tokens apart
+  prefix TEXT NOT NULL,
+  -- Space separated, e.g. "videos:read videos:write"
+  scopes TEXT NOT NULL,
+  expires_at INTEGER NOT NULL,
+  last_used_at INTEGER,
+  created_at INTEGER NOT NULL,
+  revoked_at INTEGER,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens (user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+DROP TABLE IF EXISTS api_tokens;
+
+-- +goose StatementEnd
@@ -0,0 +1,62 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+CREATE TABLE roles (
+  id TEXT PRIMARY KEY,
+  description TEXT NOT NULL
+);
+
+CREATE TABLE permissions (
+  id TEXT PRIMARY KEY,
+  description TEXT NOT NULL
+);
+
+CREATE TABLE role_permissions (
+  role_id TEXT NOT NULL,
+  permission_id TEXT NOT NULL,
+  PRIMARY KEY (role_id, permission_id),
+  FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+  FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_roles (
+  user_id TEXT NOT NULL,
+  role_id TEXT NOT NULL,
+  created_at INTEGER NOT NULL,
+  PRIMARY KEY (user_id, role_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+
+INSERT INTO roles (id, description) VALUES
+  ('admin', 'Manages every video and user'),
+  ('moderator', 'Hides content that breaks the rules');
+
+INSERT INTO permissions (id, description) VALUES
+  ('videos.manage', 'Edit, process and delete any video'),
+  ('videos.moderate', 'Hide and unhide any video'),
+  ('users.manage', 'Edit any user and assign roles');
+
+INSERT INTO role_permissions (role_id, permission_id) VALUES
+  ('admin', 'videos.manage'),
+  ('admin', 'videos.moderate'),
+  ('admin', 'users.manage'),
+  ('moderator', 'videos.moderate');
+
+-- Videos hidden by moderation stay visible only to their owner and moderators
+ALTER TABLE videos ADD COLUMN hidden_at INTEGER;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+ALTER TABLE videos DROP COLUMN hidden_at;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
+
+-- +goose StatementEnd
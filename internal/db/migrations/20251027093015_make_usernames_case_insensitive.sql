@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Usernames differing only in case were allowed until now; keep the oldest
+-- and suffix the rest with the start of their id
+UPDATE users
+SET username = substr(username, 1, 21) || '_' || substr(id, 1, 8)
+WHERE EXISTS (
+  SELECT 1 FROM users other
+  WHERE other.username = users.username COLLATE NOCASE
+    AND other.rowid < users.rowid
+);
+
+CREATE UNIQUE INDEX idx_users_username_nocase ON users (username COLLATE NOCASE);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+DROP INDEX IF EXISTS idx_users_username_nocase;
+
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Google logins stored the account's sub as the username before identities
+-- were recorded. Link those accounts so they keep signing in by sub rather
+-- than falling back to matching by email. Subs are numeric, unlike the
+-- usernames GitHub logins and password registrations produced.
+INSERT INTO identities (id, user_id, provider, subject, email, created_at)
+SELECT
+  lower(
+    hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+    substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+  ),
+  users.id, 'google', users.username, users.email, users.created_at
+FROM users
+WHERE users.deleted_at IS NULL
+  AND users.username NOT GLOB '*[^0-9]*'
+  AND length(users.username) >= 10
+  AND NOT EXISTS (
+    SELECT 1 FROM identities
+    WHERE identities.user_id = users.id AND identities.provider = 'google'
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM identities
+    WHERE identities.provider = 'google' AND identities.subject = users.username
+  );
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+-- Backfilled identities can't be told apart from ones linked at sign in, so they are kept
+
+-- +goose StatementEnd
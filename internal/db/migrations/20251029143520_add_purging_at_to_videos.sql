@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+-- Set when the reaper starts permanently deleting a video, after which it can no longer be restored
+ALTER TABLE videos ADD COLUMN purging_at INTEGER;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+ALTER TABLE videos DROP COLUMN purging_at;
+
+-- +goose StatementEnd
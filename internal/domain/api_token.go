@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ErrCodeAPITokenNotFound   ErrorCode = 1017
+	ErrCodeInsufficientScope  ErrorCode = 1018
+	ErrCodeInvalidAPITokenReq ErrorCode = 1019
+)
+
+// APITokenPrefix starts every API token, telling them apart from session tokens
+const APITokenPrefix = "tbm_"
+
+const (
+	DefaultAPITokenDays = 30
+	MaxAPITokenDays     = 365
+)
+
+// Scope is a permission an API token can be granted. Sessions have every scope.
+type Scope string
+
+const (
+	ScopeVideosRead   Scope = "videos:read"
+	ScopeVideosWrite  Scope = "videos:write"
+	ScopeProfileRead  Scope = "profile:read"
+	ScopeProfileWrite Scope = "profile:write"
+)
+
+// Scopes lists every scope an API token can be granted
+var Scopes = []Scope{ScopeVideosRead, ScopeVideosWrite, ScopeProfileRead, ScopeProfileWrite}
+
+// APIToken is a long-lived token a user creates for scripts; only its hash is stored
+type APIToken struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     string     `json:"userId" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	Scopes     []Scope    `json:"scopes" db:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt" db:"expires_at"`
+	LastUsedAt *time.Time `json:"lastUsedAt" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	RevokedAt  *time.Time `json:"-" db:"revoked_at"`
+}
+
+func (t *APIToken) HasScope(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+type CreateAPITokenReq struct {
+	Name   string  `json:"name"`
+	Scopes []Scope `json:"scopes"`
+	// Days until the token expires, DefaultAPITokenDays when zero
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+func (r *CreateAPITokenReq) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > 100 {
+		return NewAppError(ErrCodeInvalidAPITokenReq, "Name must be between 1 and 100 characters", nil)
+	}
+
+	if len(r.Scopes) == 0 {
+		return NewAppError(ErrCodeInvalidAPITokenReq, "At least one scope is required", nil)
+	}
+	for _, scope := range r.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return NewAppError(ErrCodeInvalidAPITokenReq, "Unknown scope: "+string(scope), nil)
+		}
+	}
+	slices.Sort(r.Scopes)
+	r.Scopes = slices.Compact(r.Scopes)
+
+	if r.ExpiresInDays == 0 {
+		r.ExpiresInDays = DefaultAPITokenDays
+	}
+	if r.ExpiresInDays < 1 || r.ExpiresInDays > MaxAPITokenDays {
+		return NewAppError(ErrCodeInvalidAPITokenReq, "expiresInDays must be between 1 and 365", nil)
+	}
+
+	return nil
+}
@@ -1,6 +1,10 @@
 package domain
 
-import "time"
+import (
+	"net/mail"
+	"strings"
+	"time"
+)
 
 type AuthProvider string
 
@@ -15,19 +19,213 @@ const (
 	ErrCodeAuthUserNotFound       ErrorCode = 1002
 	ErrCodeAuthInvalidProvider    ErrorCode = 1003
 	ErrCodeAuthInvalidSession     ErrorCode = 1004
+	ErrCodeAuthInvalidState       ErrorCode = 1005
+	ErrCodeAuthInvalidRedirect    ErrorCode = 1006
+	ErrCodeAuthEmailTaken         ErrorCode = 1007
+	ErrCodeAuthEmailNotVerified   ErrorCode = 1008
+	ErrCodeAuthAccountLocked      ErrorCode = 1009
+	ErrCodeAuthInvalidToken       ErrorCode = 1010
+	ErrCodeAuthInvalidPassword    ErrorCode = 1011
+	ErrCodeAuthIdentityTaken      ErrorCode = 1012
+	ErrCodeAuthAccountExists      ErrorCode = 1013
+	ErrCodeAuthIdentityNotFound   ErrorCode = 1014
+	ErrCodeAuthLastLoginMethod    ErrorCode = 1015
+	ErrCodeAuthSessionNotFound    ErrorCode = 1016
+	ErrCodeAuthSessionRotated     ErrorCode = 1020
+)
+
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 128
 )
 
 type Session struct {
+	ID     string `json:"id" db:"id"`
+	UserID string `json:"userId" db:"user_id"`
+	// Token is only known when the session is created or rotated; the database keeps its hash
+	Token      string       `json:"-" db:"-"`
+	TokenHash  string       `json:"-" db:"token_hash"`
+	Provider   AuthProvider `json:"provider" db:"provider"`
+	UserAgent  string       `json:"userAgent" db:"user_agent"`
+	IPAddress  string       `json:"ipAddress" db:"ip_address"`
+	LastSeenAt time.Time    `json:"lastSeenAt" db:"last_seen_at"`
+	RotatedAt  *time.Time   `json:"-" db:"rotated_at"`
+	ExpiredAt  time.Time    `json:"expiredAt" db:"expired_at"`
+	CreatedAt  time.Time    `json:"createdAt" db:"created_at"`
+	DeletedAt  *time.Time   `json:"deletedAt" db:"deleted_at"`
+	// Current marks the session making the request when listing sessions
+	Current bool `json:"current" db:"-"`
+}
+
+// ClientInfo describes the client a request came from, recorded on its session
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+type ValidateSessionDTO struct {
+	Session Session
+	User    User
+	// APIToken is set instead of Session when the request authenticated with an API token
+	APIToken *APIToken
+}
+
+// HasScope reports whether the request may use scope; sessions can use them all
+func (d *ValidateSessionDTO) HasScope(scope Scope) bool {
+	return d.APIToken == nil || d.APIToken.HasScope(scope)
+}
+
+// OAuthState is a login started with a provider, waiting for its callback
+type OAuthState struct {
+	State        string       `json:"-" db:"state"`
+	Provider     AuthProvider `json:"provider" db:"provider"`
+	CodeVerifier string       `json:"-" db:"code_verifier"` // PKCE verifier sent with the code exchange
+	RedirectTo   string       `json:"redirectTo" db:"redirect_to"`
+	LinkUserID   string       `json:"-" db:"link_user_id"` // signed-in user linking the provider, empty for logins
+	CreatedAt    time.Time    `json:"createdAt" db:"created_at"`
+	ExpiresAt    time.Time    `json:"expiresAt" db:"expires_at"`
+}
+
+// Identity is a provider account a user signs in with
+type Identity struct {
 	ID        string       `json:"id" db:"id"`
 	UserID    string       `json:"userId" db:"user_id"`
-	Token     string       `json:"token" db:"token"`
 	Provider  AuthProvider `json:"provider" db:"provider"`
-	ExpiredAt time.Time    `json:"expiredAt" db:"expired_at"`
+	Subject   string       `json:"-" db:"subject"` // stable ID of the account at the provider
+	Email     string       `json:"email" db:"email"`
 	CreatedAt time.Time    `json:"createdAt" db:"created_at"`
-	DeletedAt *time.Time   `json:"deletedAt" db:"deleted_at"`
 }
 
-type ValidateSessionDTO struct {
-	Session Session
-	User    User
+// LoginRedirect is where the browser is sent to sign in with a provider
+type LoginRedirect struct {
+	URL string
+	// State must also be bound to the browser, so the callback can check it came from the same one
+	State     string
+	ExpiresAt time.Time
+}
+
+// Credential is a user's password login
+type Credential struct {
+	UserID          string     `json:"userId" db:"user_id"`
+	PasswordHash    string     `json:"-" db:"password_hash"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt" db:"email_verified_at"`
+	// Consecutive failed logins since the last success or lockout
+	FailedAttempts int        `json:"failedAttempts" db:"failed_attempts"`
+	LockedUntil    *time.Time `json:"lockedUntil" db:"locked_until"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+type AuthTokenPurpose string
+
+const (
+	AuthTokenEmailVerification AuthTokenPurpose = "email_verification"
+	AuthTokenPasswordReset     AuthTokenPurpose = "password_reset"
+)
+
+// AuthToken is a single use token mailed to a user; only its hash is stored
+type AuthToken struct {
+	TokenHash string           `json:"-" db:"token_hash"`
+	UserID    string           `json:"userId" db:"user_id"`
+	Purpose   AuthTokenPurpose `json:"purpose" db:"purpose"`
+	ExpiresAt time.Time        `json:"expiresAt" db:"expires_at"`
+	UsedAt    *time.Time       `json:"usedAt" db:"used_at"`
+	CreatedAt time.Time        `json:"createdAt" db:"created_at"`
+}
+
+func validatePassword(password string) error {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return NewAppError(ErrCodeAuthInvalidPassword, "Password must be between 8 and 128 characters", nil)
+	}
+	return nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", NewAppError(ErrCodeValidation, "A valid email address is required", nil)
+	}
+	return email, nil
+}
+
+type RegisterReq struct {
+	Name     string `json:"name" form:"name"`
+	Email    string `json:"email" form:"email"`
+	Password string `json:"password" form:"password"`
+}
+
+func (r *RegisterReq) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > 100 {
+		return NewAppError(ErrCodeValidation, "Name must be between 1 and 100 characters", nil)
+	}
+	email, err := normalizeEmail(r.Email)
+	if err != nil {
+		return err
+	}
+	r.Email = email
+	return validatePassword(r.Password)
+}
+
+type PasswordLoginReq struct {
+	Email    string `json:"email" form:"email"`
+	Password string `json:"password" form:"password"`
+}
+
+func (r *PasswordLoginReq) Validate() error {
+	r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+	if r.Email == "" || r.Password == "" {
+		return NewAppError(ErrCodeValidation, "Email and password are required", nil)
+	}
+	return nil
+}
+
+// EmailReq asks for a verification or password reset email
+type EmailReq struct {
+	Email string `json:"email" form:"email"`
+}
+
+func (r *EmailReq) Validate() error {
+	email, err := normalizeEmail(r.Email)
+	if err != nil {
+		return err
+	}
+	r.Email = email
+	return nil
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token" form:"token"`
+}
+
+func (r *VerifyEmailReq) Validate() error {
+	if r.Token == "" {
+		return NewAppError(ErrCodeAuthInvalidToken, "Token is required", nil)
+	}
+	return nil
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token" form:"token"`
+	Password string `json:"password" form:"password"`
+}
+
+func (r *ResetPasswordReq) Validate() error {
+	if r.Token == "" {
+		return NewAppError(ErrCodeAuthInvalidToken, "Token is required", nil)
+	}
+	return validatePassword(r.Password)
+}
+
+type ChangePasswordReq struct {
+	CurrentPassword string `json:"currentPassword" form:"currentPassword"`
+	NewPassword     string `json:"newPassword" form:"newPassword"`
+}
+
+func (r *ChangePasswordReq) Validate() error {
+	if r.CurrentPassword == "" {
+		return NewAppError(ErrCodeValidation, "Current password is required", nil)
+	}
+	return validatePassword(r.NewPassword)
 }
@@ -0,0 +1,26 @@
+package domain
+
+const (
+	ErrCodeRoleNotFound     ErrorCode = 4001
+	ErrCodePermissionDenied ErrorCode = 4002
+)
+
+// Role groups permissions that can be assigned to users
+type Role string
+
+const (
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+)
+
+// Permission is something a role allows beyond what every user can do
+type Permission string
+
+const (
+	// PermVideosManage allows editing, processing and deleting any video
+	PermVideosManage Permission = "videos.manage"
+	// PermVideosModerate allows hiding and unhiding any video
+	PermVideosModerate Permission = "videos.moderate"
+	// PermUsersManage allows editing any user and assigning roles
+	PermUsersManage Permission = "users.manage"
+)
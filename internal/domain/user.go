@@ -1,6 +1,19 @@
 package domain
 
-import "time"
+import (
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	ErrCodeInvalidProfile     ErrorCode = 3001
+	ErrCodeUsernameTaken      ErrorCode = 3002
+	ErrCodeProfilePicNotFound ErrorCode = 3003
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{3,30}$`)
 
 type User struct {
 	ID         string     `json:"id" db:"id"`
@@ -12,3 +25,28 @@ type User struct {
 	UpdatedAt  time.Time  `json:"updatedAt" db:"updated_at"`
 	DeletedAt  *time.Time `json:"deletedAt" db:"deleted_at"`
 }
+
+// UpdateProfileReq changes the fields that are set, leaving the rest as they are
+type UpdateProfileReq struct {
+	Name     *string `json:"name" form:"name"`
+	Username *string `json:"username" form:"username"`
+	// New profile picture, a JPEG or PNG image
+	ProfilePic io.Reader `json:"-" form:"-"`
+}
+
+func (r *UpdateProfileReq) Validate() error {
+	if r.Name != nil {
+		name := strings.TrimSpace(*r.Name)
+		if name == "" || len(name) > 100 {
+			return NewAppError(ErrCodeInvalidProfile, "Name must be between 1 and 100 characters", nil)
+		}
+		r.Name = &name
+	}
+	if r.Username != nil && !usernamePattern.MatchString(*r.Username) {
+		return NewAppError(ErrCodeInvalidProfile, "Username must be 3 to 30 letters, digits or underscores", nil)
+	}
+	if r.Name == nil && r.Username == nil && r.ProfilePic == nil {
+		return NewAppError(ErrCodeInvalidProfile, "Nothing to update", nil)
+	}
+	return nil
+}
@@ -1,33 +1,48 @@
 package domain
 
 import (
+	"encoding/base64"
 	"encoding/json"
-	"path/filepath"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	ErrCodeVideoNotFound      ErrorCode = 2001
-	ErrCodeVideoInvalidID     ErrorCode = 2002
-	ErrCodeVideoDatabaseError ErrorCode = 2003
-	ErrCodeInvalidVideoData   ErrorCode = 2004
+	ErrCodeVideoNotFound          ErrorCode = 2001
+	ErrCodeVideoInvalidID         ErrorCode = 2002
+	ErrCodeVideoDatabaseError     ErrorCode = 2003
+	ErrCodeInvalidVideoData       ErrorCode = 2004
+	ErrCodeVideoAlreadyProcessing ErrorCode = 2005
+	ErrCodeInvalidThumbnail       ErrorCode = 2006
+	ErrCodeVideoNotUploaded       ErrorCode = 2007
+	ErrCodeInvalidUpload          ErrorCode = 2008
+	ErrCodeNoMultipartUpload      ErrorCode = 2009
+	ErrCodeInvalidVideoFilters    ErrorCode = 2010
+	ErrCodeVideoForbidden         ErrorCode = 2011
+	ErrCodeVideoPurging           ErrorCode = 2012
 )
 
-// CloudFront distribution URL for video streaming
-// TODO: Move this to environment configuration
-const CloudFrontDistributionURL = "https://d29kwr3nijxedo.cloudfront.net"
-
 type VideoVisibility string
 
 const (
-	VideoVisibilityPublic  VideoVisibility = "public"
-	VideoVisibilityPrivate VideoVisibility = "private"
+	VideoVisibilityPublic VideoVisibility = "public"
+	// Unlisted videos can be watched by anyone with their ID, but aren't listed or searchable
+	VideoVisibilityUnlisted VideoVisibility = "unlisted"
+	VideoVisibilityPrivate  VideoVisibility = "private"
 )
 
+// Valid reports whether v is a known visibility
+func (v VideoVisibility) Valid() bool {
+	return v == VideoVisibilityPublic || v == VideoVisibilityUnlisted || v == VideoVisibilityPrivate
+}
+
 type VideoStatus string
 
 const (
 	VideoStatusPendingUpload VideoStatus = "pending_upload"
+	VideoStatusUploaded      VideoStatus = "uploaded"
 	VideoStatusProcessing    VideoStatus = "processing"
 	VideoStatusReady         VideoStatus = "ready"
 	VideoStatusError         VideoStatus = "error"
@@ -39,19 +54,22 @@ type VideoProcessingEventType string
 const (
 	EventTypeVideoStatusUpdate        VideoProcessingEventType = "video:status:update"
 	EventTypeVideoProcessingStarted   VideoProcessingEventType = "video:processing:started"
+	EventTypeVideoProcessingProgress  VideoProcessingEventType = "video:processing:progress"
 	EventTypeVideoProcessingCompleted VideoProcessingEventType = "video:processing:completed"
 	EventTypeVideoProcessingError     VideoProcessingEventType = "video:processing:error"
 )
 
 // VideoProcessingEvent represents a video processing status update
 type VideoProcessingEvent struct {
-	VideoID   string                   `json:"videoId"`
-	EventType VideoProcessingEventType `json:"eventType"`
-	Status    VideoStatus              `json:"status"`
-	Message   string                   `json:"message"`
-	Progress  *int                     `json:"progress,omitempty"` // percentage (0-100)
-	Error     string                   `json:"error,omitempty"`
-	Timestamp time.Time                `json:"timestamp"`
+	VideoID         string                   `json:"videoId"`
+	EventType       VideoProcessingEventType `json:"eventType"`
+	Status          VideoStatus              `json:"status"`
+	Message         string                   `json:"message"`
+	Progress        *int                     `json:"progress,omitempty"`        // percentage (0-100)
+	Variant         string                   `json:"variant,omitempty"`         // rendition being transcoded
+	VariantProgress *int                     `json:"variantProgress,omitempty"` // percentage (0-100) of the current rendition
+	Error           string                   `json:"error,omitempty"`
+	Timestamp       time.Time                `json:"timestamp"`
 }
 
 // ToJSON converts the event to JSON string
@@ -69,28 +87,222 @@ type Video struct {
 	ID           string          `json:"id" db:"id"`
 	Title        string          `json:"title" db:"title"`
 	Description  string          `json:"description" db:"description"`
-	Duration     int             `json:"duration" db:"duration"`
+	Duration     int             `json:"duration" db:"duration"` // seconds
 	Views        int             `json:"views" db:"views"`
+	UserID       string          `json:"userId" db:"user_id"` // owner, empty for videos uploaded before ownership
 	Key          string          `json:"key" db:"key"`
+	UploadID     string          `json:"-" db:"upload_id"` // in-progress multipart upload of the raw video
 	ThumbnailKey string          `json:"thumbnailKey" db:"thumbnail_key"`
 	Visibility   VideoVisibility `json:"visibility" db:"visibility"`
 	Status       VideoStatus     `json:"status" db:"status"`
-	URL          string          `json:"url" db:"-"` // CloudFront URL, not stored in DB
+	URL          string          `json:"url" db:"-"` // streaming URL, not stored in DB
+	ThumbnailURL string          `json:"thumbnailUrl" db:"-"`
+	PreviewsURL  string          `json:"previewsUrl" db:"-"` // WebVTT index of the scrub preview sprite
+	// Source media details, filled in when the upload is probed
+	Width         int     `json:"width" db:"width"`
+	Height        int     `json:"height" db:"height"`
+	FrameRate     float64 `json:"frameRate" db:"frame_rate"`
+	VideoCodec    string  `json:"videoCodec" db:"video_codec"`
+	Rotation      int     `json:"rotation" db:"rotation"`
+	AudioCodec    string  `json:"audioCodec" db:"audio_codec"`
+	AudioChannels int     `json:"audioChannels" db:"audio_channels"`
 	// unix timestamp in db (integers)
 	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time  `json:"updatedAt" db:"updated_at"`
 	DeletedAt *time.Time `json:"deletedAt" db:"deleted_at"`
+	HiddenAt  *time.Time `json:"hiddenAt" db:"hidden_at"` // hidden by a moderator
+}
+
+// VisibleTo reports whether the user with userID, empty when signed out, may
+// view the video by its ID. Unlisted videos are, unlike in listings.
+func (v *Video) VisibleTo(userID string) bool {
+	if userID != "" && v.UserID == userID {
+		return true
+	}
+	if v.HiddenAt != nil {
+		return false
+	}
+	return v.Visibility == VideoVisibilityPublic || v.Visibility == VideoVisibilityUnlisted
 }
 
-// SetStreamingURL sets the CloudFront URL for the video based on its ID
-func (v *Video) SetStreamingURL() {
+// RawVideoPrefix is the storage prefix uploaded videos are written under, as <id>.mp4
+const RawVideoPrefix = "raw-videos/"
+
+// ProcessedVideoPrefix is the storage prefix processed videos and their images live under
+const ProcessedVideoPrefix = "processed-videos/"
+
+// SetStreamingURL sets the streaming, thumbnail and preview URLs for the video
+// based on its ID. baseURL serves the objects under ProcessedVideoPrefix.
+func (v *Video) SetStreamingURL(baseURL string) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
 	if v.Status == VideoStatusReady {
-		v.URL = filepath.Join(CloudFrontDistributionURL, v.ID, "playlist.m3u8")
+		v.URL = baseURL + "/" + v.ID + "/playlist.m3u8"
+		v.PreviewsURL = baseURL + "/" + v.ID + "/sprite.vtt"
+	}
+	if strings.HasPrefix(v.ThumbnailKey, ProcessedVideoPrefix) {
+		v.ThumbnailURL = baseURL + "/" + strings.TrimPrefix(v.ThumbnailKey, ProcessedVideoPrefix)
 	}
 }
 
+type VideoSort string
+
+const (
+	VideoSortCreatedAt VideoSort = "created_at"
+	VideoSortViews     VideoSort = "views"
+	VideoSortTitle     VideoSort = "title"
+)
+
+type SortOrder string
+
+const (
+	SortOrderAsc  SortOrder = "asc"
+	SortOrderDesc SortOrder = "desc"
+)
+
+const (
+	DefaultVideoPageSize = 20
+	MaxVideoPageSize     = 100
+)
+
 type VideoFilters struct {
-	ID string `json:"id"`
+	ID         string          `json:"id" query:"-"`
+	UserID     string          `json:"userId" query:"owner"`
+	Status     VideoStatus     `json:"status" query:"status"`
+	Visibility VideoVisibility `json:"visibility" query:"visibility"`
+	// Only videos created in [CreatedAfter, CreatedBefore)
+	CreatedAfter  time.Time `json:"createdAfter" query:"-"`
+	CreatedBefore time.Time `json:"createdBefore" query:"-"`
+
+	Sort  VideoSort `json:"sort" query:"sort"`
+	Order SortOrder `json:"order" query:"order"`
+	// Zero Limit returns every matching video
+	Limit  int `json:"limit" query:"limit"`
+	Offset int `json:"offset" query:"offset"`
+	// Opaque cursor from a previous page, used instead of Offset
+	Cursor string `json:"cursor" query:"cursor"`
+
+	// Decoded Cursor, set by Validate
+	After *VideoCursor `json:"-" query:"-"`
+
+	// When set, only public videos that aren't hidden and videos owned by ViewerID are returned
+	VisibleOnly bool   `json:"-" query:"-"`
+	ViewerID    string `json:"-" query:"-"`
+	// Deleted videos are only returned when set
+	IncludeDeleted bool `json:"-" query:"-"`
+}
+
+// Validate checks the filters and fills in the default sort and page size
+func (f *VideoFilters) Validate() error {
+	if f.Status != "" {
+		switch f.Status {
+		case VideoStatusPendingUpload, VideoStatusUploaded, VideoStatusProcessing, VideoStatusReady, VideoStatusError:
+		default:
+			return NewAppError(ErrCodeInvalidVideoFilters, fmt.Sprintf("Unknown status %q", f.Status), nil)
+		}
+	}
+	if f.Visibility != "" && !f.Visibility.Valid() {
+		return NewAppError(ErrCodeInvalidVideoFilters, fmt.Sprintf("Unknown visibility %q", f.Visibility), nil)
+	}
+	if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() && !f.CreatedAfter.Before(f.CreatedBefore) {
+		return NewAppError(ErrCodeInvalidVideoFilters, "createdAfter must be before createdBefore", nil)
+	}
+
+	if f.Sort == "" {
+		f.Sort = VideoSortCreatedAt
+	}
+	if f.Sort != VideoSortCreatedAt && f.Sort != VideoSortViews && f.Sort != VideoSortTitle {
+		return NewAppError(ErrCodeInvalidVideoFilters, "Sort must be created_at, views or title", nil)
+	}
+	if f.Order == "" {
+		f.Order = SortOrderDesc
+		if f.Sort == VideoSortTitle {
+			f.Order = SortOrderAsc
+		}
+	}
+	if f.Order != SortOrderAsc && f.Order != SortOrderDesc {
+		return NewAppError(ErrCodeInvalidVideoFilters, "Order must be asc or desc", nil)
+	}
+
+	if f.Limit == 0 {
+		f.Limit = DefaultVideoPageSize
+	}
+	if f.Limit < 0 || f.Limit > MaxVideoPageSize {
+		return NewAppError(ErrCodeInvalidVideoFilters, fmt.Sprintf("Limit must be between 1 and %d", MaxVideoPageSize), nil)
+	}
+	if f.Offset < 0 {
+		return NewAppError(ErrCodeInvalidVideoFilters, "Offset must not be negative", nil)
+	}
+
+	if f.Cursor != "" {
+		if f.Offset != 0 {
+			return NewAppError(ErrCodeInvalidVideoFilters, "Cursor and offset cannot be combined", nil)
+		}
+		cursor, err := decodeVideoCursor(f.Cursor)
+		if err != nil || cursor.Sort != f.Sort || cursor.Order != f.Order {
+			return NewAppError(ErrCodeInvalidVideoFilters, "Invalid cursor", err)
+		}
+		f.After = cursor
+	}
+
+	return nil
+}
+
+// NextCursor returns the cursor for the page after videos, or "" when
+// videos is the last page
+func (f *VideoFilters) NextCursor(videos []Video) string {
+	if f.Limit == 0 || len(videos) < f.Limit {
+		return ""
+	}
+
+	last := videos[len(videos)-1]
+	cursor := VideoCursor{Sort: f.Sort, Order: f.Order, ID: last.ID}
+	switch f.Sort {
+	case VideoSortViews:
+		cursor.Value = strconv.Itoa(last.Views)
+	case VideoSortTitle:
+		cursor.Value = last.Title
+	default:
+		cursor.Value = strconv.FormatInt(last.CreatedAt.Unix(), 10)
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// VideoCursor is the position of the last video on a page, in the sort it was listed by
+type VideoCursor struct {
+	Sort  VideoSort `json:"s"`
+	Order SortOrder `json:"o"`
+	Value string    `json:"v"`
+	ID    string    `json:"id"`
+}
+
+// SortValue returns the cursor's value typed to match its sort column
+func (c *VideoCursor) SortValue() any {
+	if c.Sort == VideoSortTitle {
+		return c.Value
+	}
+	n, _ := strconv.ParseInt(c.Value, 10, 64)
+	return n
+}
+
+func decodeVideoCursor(s string) (*VideoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor VideoCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.Sort != VideoSortTitle {
+		if _, err := strconv.ParseInt(cursor.Value, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	return &cursor, nil
 }
 
 type VideoService interface {
@@ -98,10 +310,57 @@ type VideoService interface {
 	GetVideos(filters VideoFilters) ([]Video, int, error)
 }
 
+type VideoSearchReq struct {
+	Query  string `query:"q"`
+	Limit  int    `query:"limit"`
+	Offset int    `query:"offset"`
+}
+
+func (r *VideoSearchReq) Validate() error {
+	r.Query = strings.TrimSpace(r.Query)
+	if r.Query == "" {
+		return NewAppError(ErrCodeInvalidVideoFilters, "Search query is required", nil)
+	}
+	if len(r.Query) > 200 {
+		return NewAppError(ErrCodeInvalidVideoFilters, "Search query must be at most 200 characters", nil)
+	}
+	if r.Limit == 0 {
+		r.Limit = DefaultVideoPageSize
+	}
+	if r.Limit < 0 || r.Limit > MaxVideoPageSize {
+		return NewAppError(ErrCodeInvalidVideoFilters, fmt.Sprintf("Limit must be between 1 and %d", MaxVideoPageSize), nil)
+	}
+	if r.Offset < 0 {
+		return NewAppError(ErrCodeInvalidVideoFilters, "Offset must not be negative", nil)
+	}
+	return nil
+}
+
+// VideoSearchResult is a video matching a search, with the matched terms
+// wrapped in <mark> tags. Highlights are HTML escaped.
+type VideoSearchResult struct {
+	Video
+	TitleHighlight       string `json:"titleHighlight"`
+	DescriptionHighlight string `json:"descriptionHighlight"`
+}
+
+type UploadMode string
+
+const (
+	UploadModeSingle    UploadMode = "single"
+	UploadModeMultipart UploadMode = "multipart"
+)
+
 type CreateVideoReq struct {
+	// Owner of the new video, taken from the session
+	UserID      string          `json:"-" form:"-"`
 	Title       string          `json:"title" form:"title"`
 	Description string          `json:"description" form:"description"`
 	Visibility  VideoVisibility `json:"visibility" form:"visibility"`
+	UploadMode  UploadMode      `json:"uploadMode" form:"uploadMode"`
+	// Size in bytes of the file to upload, used to size multipart upload parts
+	FileSize    int64  `json:"fileSize" form:"fileSize"`
+	ContentType string `json:"contentType" form:"contentType"`
 }
 
 func (r *CreateVideoReq) Validate() error {
@@ -114,11 +373,118 @@ func (r *CreateVideoReq) Validate() error {
 	if r.Visibility == "" {
 		r.Visibility = VideoVisibilityPublic // default to public
 	}
+	if !r.Visibility.Valid() {
+		return NewAppError(ErrCodeInvalidVideoData, "Visibility must be public, unlisted or private", nil)
+	}
+	if r.UploadMode == "" {
+		r.UploadMode = UploadModeSingle
+	}
+	if r.UploadMode != UploadModeSingle && r.UploadMode != UploadModeMultipart {
+		return NewAppError(ErrCodeInvalidVideoData, "Upload mode must be single or multipart", nil)
+	}
+	if r.FileSize < 0 {
+		return NewAppError(ErrCodeInvalidVideoData, "File size must not be negative", nil)
+	}
+	if r.ContentType == "" {
+		r.ContentType = "video/mp4"
+	}
+	if !strings.HasPrefix(r.ContentType, "video/") {
+		return NewAppError(ErrCodeInvalidVideoData, "Content type must be a video type", nil)
+	}
+	return nil
+}
+
+// UpdateVideoReq edits a video's details, leaving fields that are nil unchanged
+type UpdateVideoReq struct {
+	Title       *string          `json:"title"`
+	Description *string          `json:"description"`
+	Visibility  *VideoVisibility `json:"visibility"`
+}
+
+func (r *UpdateVideoReq) Validate() error {
+	if r.Title == nil && r.Description == nil && r.Visibility == nil {
+		return NewAppError(ErrCodeInvalidVideoData, "Nothing to update", nil)
+	}
+	if r.Title != nil && *r.Title == "" {
+		return NewAppError(ErrCodeInvalidVideoData, "Video title is required", nil)
+	}
+	if r.Description != nil && *r.Description == "" {
+		return NewAppError(ErrCodeInvalidVideoData, "Video description is required", nil)
+	}
+	if r.Visibility != nil && !r.Visibility.Valid() {
+		return NewAppError(ErrCodeInvalidVideoData, "Visibility must be public, unlisted or private", nil)
+	}
 	return nil
 }
 
+// VideoUpload tells the client how to upload the raw video file
+type VideoUpload struct {
+	Mode UploadMode `json:"uploadMode"`
+	// Set for single uploads, which must be sent with ContentType as their Content-Type
+	PresignedURL string `json:"presignedUrl,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+	// Set for multipart uploads; every part but the last must be PartSize bytes
+	PartSize  int64 `json:"partSize,omitempty"`
+	PartCount int   `json:"partCount,omitempty"`
+}
+
+type StartMultipartUploadReq struct {
+	FileSize    int64  `json:"fileSize"`
+	ContentType string `json:"contentType"`
+}
+
+func (r *StartMultipartUploadReq) Validate() error {
+	if r.FileSize < 0 {
+		return NewAppError(ErrCodeInvalidUpload, "File size must not be negative", nil)
+	}
+	if r.ContentType == "" {
+		r.ContentType = "video/mp4"
+	}
+	if !strings.HasPrefix(r.ContentType, "video/") {
+		return NewAppError(ErrCodeInvalidUpload, "Content type must be a video type", nil)
+	}
+	return nil
+}
+
+type PresignPartsReq struct {
+	PartNumbers []int32 `json:"partNumbers"`
+}
+
+func (r *PresignPartsReq) Validate() error {
+	if len(r.PartNumbers) == 0 {
+		return NewAppError(ErrCodeInvalidUpload, "At least one part number is required", nil)
+	}
+	if len(r.PartNumbers) > 1000 {
+		return NewAppError(ErrCodeInvalidUpload, "At most 1000 part URLs can be requested at once", nil)
+	}
+	for _, n := range r.PartNumbers {
+		if n < 1 || n > 10000 {
+			return NewAppError(ErrCodeInvalidUpload, "Part numbers must be between 1 and 10000", nil)
+		}
+	}
+	return nil
+}
+
+// PresignedPart is an upload URL for one part of a multipart upload
+type PresignedPart struct {
+	PartNumber int32  `json:"partNumber"`
+	URL        string `json:"url"`
+}
+
+type CompletePartReq struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+type CompleteMultipartUploadReq struct {
+	// Parts to assemble; when empty every uploaded part is used
+	Parts []CompletePartReq `json:"parts"`
+}
+
 type ProcessVideoReq struct {
 	VideoID string `json:"videoId"`
+	// Names of the configured renditions to produce; empty means the whole ladder
+	Renditions []string `json:"renditions"`
 }
 
 func (r *ProcessVideoReq) Validate() error {
@@ -127,3 +493,35 @@ func (r *ProcessVideoReq) Validate() error {
 	}
 	return nil
 }
+
+type ConfirmThumbnailReq struct {
+	Key string `json:"key"`
+}
+
+func (r *ConfirmThumbnailReq) Validate() error {
+	if r.Key == "" {
+		return NewAppError(ErrCodeInvalidThumbnail, "Thumbnail key is required", nil)
+	}
+	return nil
+}
+
+// VideoPurgeReport lists the deleted videos a purge removed, or in a dry run would remove
+type VideoPurgeReport struct {
+	DryRun        bool          `json:"dryRun"`
+	DeletedBefore time.Time     `json:"deletedBefore"`
+	Videos        []PurgedVideo `json:"videos"`
+	ObjectCount   int           `json:"objectCount"`
+	Bytes         int64         `json:"bytes"`
+}
+
+// PurgedVideo is a deleted video and the storage objects belonging to it
+type PurgedVideo struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deletedAt"`
+	Objects   []string  `json:"objects"`
+	Bytes     int64     `json:"bytes"`
+	// Set when the video couldn't be purged; it is retried on the next run
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVideoFiltersValidateDefaults(t *testing.T) {
+	tests := []struct {
+		sort      VideoSort
+		wantSort  VideoSort
+		wantOrder SortOrder
+	}{
+		{"", VideoSortCreatedAt, SortOrderDesc},
+		{VideoSortViews, VideoSortViews, SortOrderDesc},
+		{VideoSortTitle, VideoSortTitle, SortOrderAsc},
+	}
+
+	for _, tt := range tests {
+		f := VideoFilters{Sort: tt.sort}
+		if err := f.Validate(); err != nil {
+			t.Fatalf("Validate(sort %q): %v", tt.sort, err)
+		}
+		if f.Sort != tt.wantSort || f.Order != tt.wantOrder || f.Limit != DefaultVideoPageSize {
+			t.Errorf("sort %q: got %s %s limit %d, want %s %s limit %d",
+				tt.sort, f.Sort, f.Order, f.Limit, tt.wantSort, tt.wantOrder, DefaultVideoPageSize)
+		}
+	}
+}
+
+func TestVideoFiltersValidateRejects(t *testing.T) {
+	cursor := (&VideoFilters{Sort: VideoSortViews, Order: SortOrderDesc, Limit: 1}).NextCursor([]Video{{ID: "a", Views: 3}})
+
+	tests := []struct {
+		name    string
+		filters VideoFilters
+	}{
+		{"unknown status", VideoFilters{Status: "deleted"}},
+		{"unknown visibility", VideoFilters{Visibility: "secret"}},
+		{"unknown sort", VideoFilters{Sort: "duration"}},
+		{"unknown order", VideoFilters{Order: "up"}},
+		{"negative limit", VideoFilters{Limit: -1}},
+		{"limit too large", VideoFilters{Limit: MaxVideoPageSize + 1}},
+		{"negative offset", VideoFilters{Offset: -1}},
+		{"empty date range", VideoFilters{CreatedAfter: time.Unix(100, 0), CreatedBefore: time.Unix(100, 0)}},
+		{"cursor with offset", VideoFilters{Sort: VideoSortViews, Cursor: cursor, Offset: 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filters.Validate()
+			var appErr *AppError
+			if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidVideoFilters {
+				t.Errorf("got %v, want ErrCodeInvalidVideoFilters", err)
+			}
+		})
+	}
+}
+
+func TestVideoCursorRoundTrip(t *testing.T) {
+	last := Video{ID: "b7e1", Title: "Cats, again", Views: 42, CreatedAt: time.Unix(1700000000, 0)}
+	wantValues := map[VideoSort]any{
+		VideoSortCreatedAt: int64(1700000000),
+		VideoSortViews:     int64(42),
+		VideoSortTitle:     "Cats, again",
+	}
+
+	for sort, wantValue := range wantValues {
+		for _, order := range []SortOrder{SortOrderAsc, SortOrderDesc} {
+			t.Run(string(sort)+" "+string(order), func(t *testing.T) {
+				page := VideoFilters{Sort: sort, Order: order, Limit: 2}
+				cursor := page.NextCursor([]Video{{ID: "a"}, last})
+				if cursor == "" {
+					t.Fatal("full page has no next cursor")
+				}
+
+				next := VideoFilters{Sort: sort, Order: order, Limit: 2, Cursor: cursor}
+				if err := next.Validate(); err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				if next.After.ID != last.ID || next.After.SortValue() != wantValue {
+					t.Errorf("cursor points at %s %v, want %s %v", next.After.ID, next.After.SortValue(), last.ID, wantValue)
+				}
+			})
+		}
+	}
+}
+
+func TestVideoCursorRejectsOtherListing(t *testing.T) {
+	cursor := (&VideoFilters{Sort: VideoSortViews, Order: SortOrderDesc, Limit: 1}).NextCursor([]Video{{ID: "a", Views: 3}})
+
+	tests := []struct {
+		name  string
+		sort  VideoSort
+		order SortOrder
+	}{
+		{"other sort", VideoSortCreatedAt, SortOrderDesc},
+		{"other order", VideoSortViews, SortOrderAsc},
+		{"default title order", VideoSortTitle, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := VideoFilters{Sort: tt.sort, Order: tt.order, Cursor: cursor}
+			if err := f.Validate(); err == nil {
+				t.Errorf("cursor for views desc accepted for %s %s", f.Sort, f.Order)
+			}
+		})
+	}
+}
+
+func TestVideoCursorRejectsMalformed(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	for name, cursor := range map[string]string{
+		"not base64":        "%%%",
+		"not JSON":          encode("views"),
+		"non-numeric views": encode(`{"s":"views","o":"desc","v":"many","id":"a"}`),
+		"non-numeric time":  encode(`{"s":"created_at","o":"desc","v":"yesterday","id":"a"}`),
+		"padded base64":     base64.URLEncoding.EncodeToString([]byte(`{"s":"views","o":"desc","v":"1","id":"a"}`)),
+		"standard alphabet": base64.StdEncoding.EncodeToString([]byte(`{"s":"views","o":"desc","v":"1","id":"a?>"}`)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := VideoFilters{Sort: VideoSortViews, Order: SortOrderDesc, Cursor: cursor}
+			if err := f.Validate(); err == nil {
+				t.Errorf("malformed cursor %q accepted", cursor)
+			}
+		})
+	}
+}
+
+func TestNextCursorOnLastPage(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		videos int
+	}{
+		{"short page", 3, 2},
+		{"empty page", 3, 0},
+		{"unpaged", 0, 5},
+	}
+
+	for _, tt := range tests {
+		f := VideoFilters{Sort: VideoSortCreatedAt, Order: SortOrderDesc, Limit: tt.limit}
+		if cursor := f.NextCursor(make([]Video, tt.videos)); cursor != "" {
+			t.Errorf("%s: got cursor %q, want none", tt.name, cursor)
+		}
+	}
+}
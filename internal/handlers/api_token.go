@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+func (h *Handlers) ListAPITokens(c *fiber.Ctx) error {
+	tokens, err := h.authService.ListAPITokens(c.Context(), h.currentUserID(c))
+	if err != nil {
+		slog.Error("Failed to list API tokens", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "API tokens retrieved successfully",
+		"data":    tokens,
+	})
+}
+
+// CreateAPIToken creates a personal API token. The token is only ever
+// included in this response.
+func (h *Handlers) CreateAPIToken(c *fiber.Ctx) error {
+	reqPayload := new(domain.CreateAPITokenReq)
+	if err := c.BodyParser(reqPayload); err != nil {
+		return invalidPayload(c)
+	}
+
+	apiToken, token, err := h.authService.CreateAPIToken(c.Context(), h.currentUserID(c), *reqPayload)
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeInvalidAPITokenReq {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		}
+		slog.Error("Failed to create API token", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "API token created successfully, copy it now as it won't be shown again",
+		"data": fiber.Map{
+			"apiToken": apiToken,
+			"token":    token,
+		},
+	})
+}
+
+func (h *Handlers) RevokeAPIToken(c *fiber.Ctx) error {
+	if err := h.authService.RevokeAPIToken(c.Context(), h.currentUserID(c), c.Params("id")); err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeAPITokenNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		}
+		slog.Error("Failed to revoke API token", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "API token revoked successfully",
+	})
+}
@@ -1,17 +1,41 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/middleware"
 )
 
+// oauthStateCookieName binds a login's state to the browser that started it
+const oauthStateCookieName = "t_oauth_state"
+
 func (h *Handlers) LoginWithProvider(c *fiber.Ctx) error {
 	provider := c.Params("provider")
 
-	url, err := h.authService.LoginWithProvider(domain.AuthProvider(provider))
+	login, err := h.authService.LoginWithProvider(c.Context(), domain.AuthProvider(provider), c.Query("redirect_to"))
 	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeAuthInvalidProvider:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			case domain.ErrCodeAuthInvalidRedirect:
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			}
+		}
 		slog.Error("Failed to get login URL", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -20,42 +44,76 @@ func (h *Handlers) LoginWithProvider(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.Redirect(url, fiber.StatusFound)
+	return redirectToProvider(c, login)
+}
+
+// redirectToProvider sends the browser to the provider, binding the login's state to it
+func redirectToProvider(c *fiber.Ctx, login *domain.LoginRedirect) error {
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookieName,
+		Value:    login.State,
+		Path:     "/auth",
+		Expires:  login.ExpiresAt,
+		HTTPOnly: true,
+		// Lax still sends the cookie on the provider's top-level redirect back to us
+		SameSite: "Lax",
+		Secure:   c.Protocol() == "https",
+	})
+
+	return c.Redirect(login.URL, fiber.StatusFound)
 }
 
 func (h *Handlers) HandleProviderCallback(c *fiber.Ctx) error {
 	provider := c.Params("provider")
 	code := c.Query("code")
-	// state := c.Query("state")
+	state := c.Query("state")
+
+	loginError := func(reason string) error {
+		return c.Redirect(h.authService.DefaultRedirect()+"login?error="+reason, fiber.StatusTemporaryRedirect)
+	}
 
-	// if state != "state" {
-	// 	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-	// 		"success": false,
-	// 		"message": "Invalid state parameter",
-	// 		"code":    domain.ErrCodeValidation,
-	// 	})
-	// }
+	// The state must come back to the browser that started the login
+	cookieState := c.Cookies(oauthStateCookieName)
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookieName,
+		Path:     "/auth",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		slog.Warn("OAuth callback state does not match the browser", "provider", provider)
+		return loginError("invalid_state")
+	}
 
-	session, err := h.authService.HandleProviderCallback(c.Context(), domain.AuthProvider(provider), code)
+	session, redirectTo, err := h.authService.HandleProviderCallback(c.Context(), domain.AuthProvider(provider), code, state, middleware.ClientInfo(c))
 	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeAuthInvalidState:
+				slog.Warn("OAuth callback with unknown or expired state", "provider", provider)
+				return loginError("invalid_state")
+			case domain.ErrCodeAuthAccountExists:
+				return loginError("account_exists")
+			case domain.ErrCodeAuthIdentityTaken:
+				return loginError("identity_taken")
+			}
+		}
 		slog.Error("Failed to get user info", "error", err)
-		return c.Redirect("http://localhost:3000/login?error=failed_to_get_user_info", fiber.StatusTemporaryRedirect)
+		return loginError("failed_to_get_user_info")
 	}
 
-	cookie := new(fiber.Cookie)
-	cookie.Name = "t_session_id"
-	cookie.Value = session.Token
-	cookie.Expires = session.ExpiredAt
-	cookie.HTTPOnly = true
-	cookie.SameSite = "Lax"
-
-	c.Cookie(cookie)
+	// Linking a provider keeps the session the user already has
+	if session != nil {
+		middleware.SetSessionCookie(c, session)
+	}
 
-	return c.Redirect("http://localhost:3000/", fiber.StatusFound)
+	return c.Redirect(redirectTo, fiber.StatusFound)
 }
 
 func (h *Handlers) Logout(c *fiber.Ctx) error {
-	err := h.authService.Logout(c.Context(), c.Cookies("t_session_id"))
+	err := h.authService.Logout(c.Context(), middleware.SessionToken(c))
 
 	if err != nil {
 		slog.Error("Failed to logout", "error", err)
@@ -66,10 +124,23 @@ func (h *Handlers) Logout(c *fiber.Ctx) error {
 		})
 	}
 
-	c.ClearCookie("t_session_id")
+	c.ClearCookie(middleware.SessionCookieName)
 
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Logged out successfully",
 	})
 }
+
+// currentSession returns the signed-in user's session, or nil for anonymous requests
+func (h *Handlers) currentSession(c *fiber.Ctx) *domain.ValidateSessionDTO {
+	return middleware.Session(c)
+}
+
+// currentUserID returns the signed-in user's ID, or "" when signed out
+func (h *Handlers) currentUserID(c *fiber.Ctx) string {
+	if session := middleware.Session(c); session != nil {
+		return session.User.ID
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+func (h *Handlers) ListIdentities(c *fiber.Ctx) error {
+	identities, err := h.authService.ListIdentities(c.Context(), h.currentUserID(c))
+	if err != nil {
+		slog.Error("Failed to list identities", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Identities retrieved successfully",
+		"data":    identities,
+	})
+}
+
+// LinkProvider starts the provider's OAuth flow to link its account to the
+// signed-in user, who is sent back to redirect_to afterwards
+func (h *Handlers) LinkProvider(c *fiber.Ctx) error {
+	provider := domain.AuthProvider(c.Params("provider"))
+
+	login, err := h.authService.LinkProvider(c.Context(), h.currentUserID(c), provider, c.Query("redirect_to"))
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeAuthInvalidProvider:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			case domain.ErrCodeAuthInvalidRedirect:
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			}
+		}
+		slog.Error("Failed to get link URL", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return redirectToProvider(c, login)
+}
+
+func (h *Handlers) UnlinkProvider(c *fiber.Ctx) error {
+	provider := domain.AuthProvider(c.Params("provider"))
+
+	if err := h.authService.UnlinkProvider(c.Context(), h.currentUserID(c), provider); err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeAuthIdentityNotFound:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			case domain.ErrCodeAuthLastLoginMethod:
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			}
+		}
+		slog.Error("Failed to unlink identity", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Provider unlinked successfully",
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/ingest"
+)
+
+// HandleS3Events accepts S3 event notifications for bucket, delivered directly
+// or via SNS, and passes each ObjectCreated event to handle. Requests must
+// carry token in the X-Ingest-Token header, as a bearer token, or in the token
+// query parameter for senders such as SNS that can't set headers. SNS messages
+// must be signed by SNS, and subscriptions to the endpoint are confirmed as
+// they arrive.
+func HandleS3Events(token string, bucket string, handle ingest.Handler) fiber.Handler {
+	verifier := ingest.NewSNSVerifier(&http.Client{Timeout: 10 * time.Second})
+
+	return func(c *fiber.Ctx) error {
+		provided := c.Get("X-Ingest-Token")
+		if provided == "" {
+			provided = strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		}
+		if provided == "" {
+			provided = c.Query("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid ingest token",
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+
+		body := c.Body()
+		message, err := ingest.ParseSNSMessage(body)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+
+		if message != nil {
+			if err := verifier.Verify(c.Context(), message); err != nil {
+				slog.Warn("rejected SNS message", "topicArn", message.TopicArn, "error", err)
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid SNS signature",
+					"code":    domain.ErrCodeValidation,
+				})
+			}
+
+			switch message.Type {
+			case ingest.SNSTypeSubscriptionConfirmation:
+				if err := verifier.Confirm(c.Context(), message); err != nil {
+					slog.Error("failed to confirm SNS subscription", "topicArn", message.TopicArn, "error", err)
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+						"success": false,
+						"message": "Internal Server Error",
+						"code":    9999,
+					})
+				}
+				slog.Info("confirmed SNS subscription", "topicArn", message.TopicArn)
+				return c.JSON(fiber.Map{
+					"success": true,
+					"message": "Subscription confirmed",
+				})
+			case ingest.SNSTypeNotification:
+				body = []byte(message.Message)
+			default:
+				return c.JSON(fiber.Map{
+					"success": true,
+					"message": "Message ignored",
+				})
+			}
+		}
+
+		events, err := ingest.ParseS3Notification(body)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+
+		var failed int
+		for _, event := range events {
+			if !event.IsObjectCreated() {
+				continue
+			}
+			if event.Bucket != "" && event.Bucket != bucket {
+				slog.Warn("ignored storage event for another bucket", "bucket", event.Bucket, "key", event.Key)
+				continue
+			}
+
+			if err := handle(c.Context(), event); err != nil {
+				var domainErr *domain.AppError
+				if errors.As(err, &domainErr) {
+					slog.Warn("storage event rejected", "key", event.Key, "error", err)
+					continue
+				}
+				slog.Error("failed to handle storage event", "key", event.Key, "error", err)
+				failed++
+			}
+		}
+
+		// Let the sender retry when something transient went wrong
+		if failed > 0 {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Internal Server Error",
+				"code":    9999,
+			})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"success": true,
+			"message": "Events accepted",
+			"count":   len(events),
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// multipartError maps errors from the multipart upload endpoints to a response
+func multipartError(c *fiber.Ctx, err error) error {
+	var domainErr *domain.AppError
+	if errors.As(err, &domainErr) {
+		switch domainErr.Code {
+		case domain.ErrCodeVideoNotFound:
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		case domain.ErrCodeInvalidUpload:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		case domain.ErrCodeNoMultipartUpload, domain.ErrCodeVideoNotUploaded:
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Internal Server Error",
+				"code":    domainErr.Code,
+			})
+		}
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Internal Server Error",
+		"code":    9999,
+	})
+}
+
+func (h *Handlers) StartMultipartUpload(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	reqPayload := new(domain.StartMultipartUploadReq)
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(reqPayload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request payload",
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+	}
+
+	upload, err := h.videoService.StartMultipartUpload(c.Context(), c.Params("id"), *reqPayload)
+	if err != nil {
+		return multipartError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Multipart upload started",
+		"data":    upload,
+	})
+}
+
+func (h *Handlers) PresignUploadParts(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	reqPayload := new(domain.PresignPartsReq)
+
+	if err := c.BodyParser(reqPayload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    domain.ErrCodeValidation,
+		})
+	}
+
+	parts, err := h.videoService.PresignUploadParts(c.Context(), c.Params("id"), *reqPayload)
+	if err != nil {
+		return multipartError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Part upload URLs created successfully",
+		"data":    parts,
+	})
+}
+
+func (h *Handlers) ListUploadParts(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	parts, err := h.videoService.ListUploadParts(c.Context(), c.Params("id"))
+	if err != nil {
+		return multipartError(c, err)
+	}
+
+	data := make([]fiber.Map, 0, len(parts))
+	for _, part := range parts {
+		data = append(data, fiber.Map{
+			"partNumber": part.PartNumber,
+			"etag":       part.ETag,
+			"size":       part.Size,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Uploaded parts retrieved successfully",
+		"data":    data,
+		"count":   len(data),
+	})
+}
+
+func (h *Handlers) CompleteMultipartUpload(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	reqPayload := new(domain.CompleteMultipartUploadReq)
+
+	// The body is optional; without one every uploaded part is assembled
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(reqPayload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request payload",
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+	}
+
+	video, err := h.videoService.CompleteMultipartUpload(c.Context(), c.Params("id"), *reqPayload)
+	if err != nil {
+		return multipartError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Video upload confirmed",
+		"data":    video,
+	})
+}
+
+func (h *Handlers) AbortMultipartUpload(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	if err := h.videoService.AbortMultipartUpload(c.Context(), c.Params("id")); err != nil {
+		return multipartError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Multipart upload aborted",
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// authorizeVideoOwner checks that the signed-in user owns the video in the
+// :id param, or may manage any video. When they can't, it writes the error
+// response and returns false.
+func (h *Handlers) authorizeVideoOwner(c *fiber.Ctx) (bool, error) {
+	return h.authorizeOwnerWith(c, h.videoService.AuthorizeOwner)
+}
+
+// authorizeDeletedVideoOwner is authorizeVideoOwner for a video that has been deleted
+func (h *Handlers) authorizeDeletedVideoOwner(c *fiber.Ctx) (bool, error) {
+	return h.authorizeOwnerWith(c, h.videoService.AuthorizeDeletedOwner)
+}
+
+func (h *Handlers) authorizeOwnerWith(c *fiber.Ctx, authorize func(ctx context.Context, videoID string, userID string) (*domain.Video, error)) (bool, error) {
+	session := h.currentSession(c)
+	if session == nil {
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
+	_, err := authorize(c.Context(), c.Params("id"), session.User.ID)
+	if err == nil {
+		return true, nil
+	}
+
+	var domainErr *domain.AppError
+	if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeVideoForbidden && h.can(c, domain.PermVideosManage) {
+		return true, nil
+	}
+
+	if errors.As(err, &domainErr) {
+		switch domainErr.Code {
+		case domain.ErrCodeVideoNotFound:
+			return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		case domain.ErrCodeVideoForbidden:
+			return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		default:
+			return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Internal Server Error",
+				"code":    domainErr.Code,
+			})
+		}
+	}
+	return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Internal Server Error",
+		"code":    9999,
+	})
+}
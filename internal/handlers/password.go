@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/middleware"
+)
+
+// passwordAuthError writes the response for an error from the password login endpoints
+func passwordAuthError(c *fiber.Ctx, err error, action string) error {
+	var domainErr *domain.AppError
+	if errors.As(err, &domainErr) {
+		switch domainErr.Code {
+		case domain.ErrCodeValidation, domain.ErrCodeAuthInvalidPassword, domain.ErrCodeAuthInvalidToken:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		case domain.ErrCodeAuthInvalidCredentials:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		case domain.ErrCodeAuthEmailNotVerified:
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		case domain.ErrCodeAuthEmailTaken:
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		case domain.ErrCodeAuthAccountLocked:
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		}
+	}
+
+	slog.Error("Failed to "+action, "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Internal Server Error",
+		"code":    9999,
+	})
+}
+
+func invalidPayload(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"success": false,
+		"message": "Invalid request payload",
+		"code":    domain.ErrCodeValidation,
+	})
+}
+
+func (h *Handlers) Register(c *fiber.Ctx) error {
+	reqPayload := new(domain.RegisterReq)
+	if err := c.BodyParser(reqPayload); err != nil {
+		return invalidPayload(c)
+	}
+
+	user, err := h.authService.Register(c.Context(), *reqPayload)
+	if err != nil {
+		return passwordAuthError(c, err, "register")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Account created, check your email to verify it",
+		"data":    user,
+	})
+}
+
+func (h *Handlers) LoginWithPassword(c *fiber.Ctx) error {
+	reqPayload := new(domain.PasswordLoginReq)
+	if err := c.BodyParser(reqPayload); err != nil {
+		return invalidPayload(c)
+	}
+
+	session, err := h.authService.LoginWithPassword(c.Context(), *reqPayload, middleware.ClientInfo(c))
+	if err != nil {
+		return passwordAuthError(c, err, "log in with password")
+	}
+
+	middleware.SetSessionCookie(c, session)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Logged in successfully",
+		"data": fiber.Map{
+			"token":     session.Token,
+			"expiredAt": session.ExpiredAt,
+		},
+	})
+}
+
+func (h *Handlers) VerifyEmail(c *fiber.Ctx) error {
+	reqPayload := new(domain.VerifyEmailReq)
+	if err := c.BodyParser(reqPayload); err != nil {
+		return invalidPayload(c)
+	}
+
+	if err := h.authService.VerifyEmail(c.Context(), *reqPayload); err != nil {
+		return passwordAuthError(c, err, "verify email")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Email verified successfully",
+	})
+}
+
+func (h *Handlers) ResendVerification(c *fiber.Ctx) error {
+	reqPayload := new(domain.EmailReq)
+	if err := c.BodyParser(reqPayload); err != nil {
+		return invalidPayload(c)
+	}
+
+	if err := h.authService.ResendVerification(c.Context(), *reqPayload); err != nil {
+		return passwordAuthError(c, err, "resend verification email")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"message": "If the account needs verifying, an email has been sent",
+	})
+}
+
+func (h *Handlers) ForgotPassword(c *fiber.Ctx) error {
+	reqPayload := new(domain.EmailReq)
+	if err := c.BodyParser(reqPayload); err != nil {
+		return invalidPayload(c)
+	}
+
+	if err := h.authService.RequestPasswordReset(c.Context(), *reqPayload); err != nil {
+		return passwordAuthError(c, err, "request password reset")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"message": "If an account exists for this email, a reset link has been sent",
+	})
+}
+
+func (h *Handlers) ResetPassword(c *fiber.Ctx) error {
+	reqPayload := new(domain.ResetPasswordReq)
+	if err := c.BodyParser(reqPayload); err != nil {
+		return invalidPayload(c)
+	}
+
+	if err := h.authService.ResetPassword(c.Context(), *reqPayload); err != nil {
+		return passwordAuthError(c, err, "reset password")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Password reset successfully",
+	})
+}
+
+func (h *Handlers) ChangePassword(c *fiber.Ctx) error {
+	session := h.currentSession(c)
+	if session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
+	reqPayload := new(domain.ChangePasswordReq)
+	if err := c.BodyParser(reqPayload); err != nil {
+		return invalidPayload(c)
+	}
+
+	if err := h.authService.ChangePassword(c.Context(), &session.Session, *reqPayload); err != nil {
+		return passwordAuthError(c, err, "change password")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Password changed successfully",
+	})
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/services"
+)
+
+// HandlePurgeReport reports which deleted videos the reaper would purge next, without removing them
+func HandlePurgeReport(reaper *services.VideoReaper) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report, err := reaper.Report(c.Context())
+		if err != nil {
+			slog.Error("Failed to build purge report", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Internal Server Error",
+				"code":    9999,
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": "Purge report generated successfully",
+			"data":    report,
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// can reports whether the signed-in user's roles grant permission. Requests
+// made with an API token never carry role permissions.
+func (h *Handlers) can(c *fiber.Ctx, permission domain.Permission) bool {
+	session := h.currentSession(c)
+	if session == nil || session.APIToken != nil {
+		return false
+	}
+
+	allowed, err := h.roleService.Can(c.Context(), session.User.ID, permission)
+	if err != nil {
+		slog.Error("Failed to check permission", "userId", session.User.ID, "permission", permission, "error", err)
+		return false
+	}
+	return allowed
+}
+
+// canView reports whether the signed-in user may view the video by its ID.
+// Moderators can see hidden public and unlisted videos so they can review
+// them, but private videos stay with their owner and video managers.
+func (h *Handlers) canView(c *fiber.Ctx, video *domain.Video) bool {
+	if video.VisibleTo(h.currentUserID(c)) {
+		return true
+	}
+	if video.Visibility != domain.VideoVisibilityPrivate && h.can(c, domain.PermVideosModerate) {
+		return true
+	}
+	return h.can(c, domain.PermVideosManage)
+}
+
+// RequirePermission only lets through signed-in users whose roles grant permission
+func (h *Handlers) RequirePermission(permission domain.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !h.can(c, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": "You don't have permission to do this",
+				"code":    domain.ErrCodePermissionDenied,
+			})
+		}
+		return c.Next()
+	}
+}
+
+func (h *Handlers) HideVideo(c *fiber.Ctx) error {
+	return h.setVideoHidden(c, true)
+}
+
+func (h *Handlers) UnhideVideo(c *fiber.Ctx) error {
+	return h.setVideoHidden(c, false)
+}
+
+func (h *Handlers) setVideoHidden(c *fiber.Ctx, hidden bool) error {
+	video, err := h.videoService.SetHidden(c.Context(), c.Params("id"), hidden)
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeVideoNotFound:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			default:
+				slog.Error("Failed to set video hidden", "videoId", c.Params("id"), "hidden", hidden, "error", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Internal Server Error",
+					"code":    domainErr.Code,
+				})
+			}
+		}
+		slog.Error("Failed to set video hidden", "videoId", c.Params("id"), "hidden", hidden, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	message := "Video unhidden successfully"
+	if hidden {
+		message = "Video hidden successfully"
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": message,
+		"data":    video,
+	})
+}
+
+// GetUser returns any user along with their roles
+func (h *Handlers) GetUser(c *fiber.Ctx) error {
+	user, err := h.userService.GetUser(c.Context(), c.Params("id"))
+	if err != nil {
+		return userError(c, err)
+	}
+
+	roles, err := h.roleService.UserRoles(c.Context(), user.ID)
+	if err != nil {
+		return userError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "User retrieved successfully",
+		"data": fiber.Map{
+			"user":  user,
+			"roles": roles,
+		},
+	})
+}
+
+// UpdateUser edits any user's profile, accepting the same payload as UpdateMe
+func (h *Handlers) UpdateUser(c *fiber.Ctx) error {
+	return h.updateProfile(c, c.Params("id"))
+}
+
+func (h *Handlers) AssignRole(c *fiber.Ctx) error {
+	if err := h.roleService.AssignRole(c.Context(), c.Params("id"), domain.Role(c.Params("role"))); err != nil {
+		return userError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Role assigned successfully",
+	})
+}
+
+func (h *Handlers) RemoveRole(c *fiber.Ctx) error {
+	if err := h.roleService.RemoveRole(c.Context(), c.Params("id"), domain.Role(c.Params("role"))); err != nil {
+		return userError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Role removed successfully",
+	})
+}
+
+func userError(c *fiber.Ctx, err error) error {
+	var domainErr *domain.AppError
+	if errors.As(err, &domainErr) {
+		switch domainErr.Code {
+		case domain.ErrCodeAuthUserNotFound, domain.ErrCodeRoleNotFound:
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		default:
+			slog.Error("Failed to manage user", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Internal Server Error",
+				"code":    domainErr.Code,
+			})
+		}
+	}
+	slog.Error("Failed to manage user", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Internal Server Error",
+		"code":    9999,
+	})
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/middleware"
+)
+
+func (h *Handlers) ListSessions(c *fiber.Ctx) error {
+	session := h.currentSession(c)
+	if session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
+	sessions, err := h.authService.ListSessions(c.Context(), &session.Session)
+	if err != nil {
+		slog.Error("Failed to list sessions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Sessions retrieved successfully",
+		"data":    sessions,
+	})
+}
+
+// RevokeSession ends one of the signed-in user's sessions, which may be the current one
+func (h *Handlers) RevokeSession(c *fiber.Ctx) error {
+	session := h.currentSession(c)
+	if session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
+	sessionID := c.Params("id")
+	if err := h.authService.RevokeSession(c.Context(), session.User.ID, sessionID); err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeAuthSessionNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		}
+		slog.Error("Failed to revoke session", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	if sessionID == session.Session.ID {
+		c.ClearCookie(middleware.SessionCookieName)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeOtherSessions signs the user out everywhere except the current session
+func (h *Handlers) RevokeOtherSessions(c *fiber.Ctx) error {
+	session := h.currentSession(c)
+	if session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
+	if err := h.authService.RevokeOtherSessions(c.Context(), &session.Session); err != nil {
+		slog.Error("Failed to revoke sessions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Other sessions revoked successfully",
+	})
+}
+
+// RotateSession replaces the current session's token. Cookie sessions are
+// rotated automatically; clients using a bearer token call this themselves.
+func (h *Handlers) RotateSession(c *fiber.Ctx) error {
+	session := h.currentSession(c)
+	if session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
+	rotated, err := h.authService.RotateSession(c.Context(), &session.Session)
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeAuthSessionRotated {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		}
+		slog.Error("Failed to rotate session", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	middleware.SetSessionCookie(c, rotated)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Session rotated successfully",
+		"data": fiber.Map{
+			"token":     rotated.Token,
+			"expiredAt": rotated.ExpiredAt,
+		},
+	})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"log/slog"
 	"runtime/debug"
@@ -12,7 +13,8 @@ import (
 	"github.com/thantko20/tubbym-backend/internal/pubsub"
 )
 
-func HandleVideoProcessingSSE(broker *pubsub.Broker) fiber.Handler {
+// HandleVideoProcessingSSE streams a video's processing updates to anyone allowed to view the video
+func (h *Handlers) HandleVideoProcessingSSE(broker *pubsub.Broker) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Set SSE headers
 		c.Set("Content-Type", "text/event-stream")
@@ -26,6 +28,19 @@ func HandleVideoProcessingSSE(broker *pubsub.Broker) fiber.Handler {
 			return c.Status(fiber.StatusBadRequest).SendString("event: error\ndata: {\"error\": \"Video ID is required\"}\n\n")
 		}
 
+		video, err := h.videoService.GetVideoByID(c.Context(), videoID)
+		if err == nil && !h.canView(c, video) {
+			err = domain.NewAppError(domain.ErrCodeVideoNotFound, "Video not found", nil)
+		}
+		if err != nil {
+			var domainErr *domain.AppError
+			if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeVideoNotFound {
+				return c.Status(fiber.StatusNotFound).SendString("event: error\ndata: {\"error\": \"Video not found\"}\n\n")
+			}
+			slog.Error("Failed to load video for SSE", "videoId", videoID, "error", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("event: error\ndata: {\"error\": \"Internal Server Error\"}\n\n")
+		}
+
 		// Subscribe to the video processing topic
 		topic := domain.GetVideoProcessingTopic(videoID)
 		client := broker.Subscribe(topic)
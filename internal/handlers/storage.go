@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/storage"
+)
+
+// HandleLocalUpload accepts uploads to the presigned URLs issued by the local storage backend
+func HandleLocalUpload(store *storage.LocalStorage) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, err := url.PathUnescape(c.Params("*"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid object key",
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+
+		expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid upload URL",
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+
+		uploadID := c.Query("uploadId")
+		var partNumber int32
+		if uploadID != "" {
+			n, err := strconv.ParseInt(c.Query("partNumber"), 10, 32)
+			if err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid upload URL",
+					"code":    domain.ErrCodeValidation,
+				})
+			}
+			partNumber = int32(n)
+		}
+
+		contentType := c.Query("contentType")
+		if contentType != "" && c.Get(fiber.HeaderContentType) != contentType {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": "Content-Type must be " + contentType,
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+
+		if err := store.VerifyUploadURL(key, uploadID, partNumber, contentType, expires, c.Query("signature")); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+
+		var body io.Reader = c.Context().RequestBodyStream()
+		if body == nil {
+			body = bytes.NewReader(c.Body())
+		}
+
+		if uploadID != "" {
+			etag, err := store.PutPart(c.Context(), key, uploadID, partNumber, body)
+			if err != nil {
+				if errors.Is(err, storage.ErrUploadNotFound) {
+					return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+						"success": false,
+						"message": "Multipart upload not found",
+						"code":    domain.ErrCodeValidation,
+					})
+				}
+				slog.Error("Failed to store upload part", "key", key, "uploadId", uploadID, "partNumber", partNumber, "error", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Internal Server Error",
+					"code":    9999,
+				})
+			}
+
+			c.Set(fiber.HeaderETag, etag)
+			return c.SendStatus(fiber.StatusOK)
+		}
+
+		if err := store.Put(c.Context(), key, body); err != nil {
+			if errors.Is(err, storage.ErrInvalidKey) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid object key",
+					"code":    domain.ErrCodeValidation,
+				})
+			}
+			slog.Error("Failed to store upload", "key", key, "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Internal Server Error",
+				"code":    9999,
+			})
+		}
+
+		return c.SendStatus(fiber.StatusOK)
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+func (h *Handlers) GetMe(c *fiber.Ctx) error {
+	session := h.currentSession(c)
+	if session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "User retrieved successfully",
+		"data":    session.User,
+	})
+}
+
+// UpdateMe edits the signed-in user's profile. It accepts JSON, or a
+// multipart form when a new profilePic file is included.
+func (h *Handlers) UpdateMe(c *fiber.Ctx) error {
+	session := h.currentSession(c)
+	if session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
+	return h.updateProfile(c, session.User.ID)
+}
+
+// updateProfile applies the profile edit in the request body to the user with userID
+func (h *Handlers) updateProfile(c *fiber.Ctx, userID string) error {
+	reqPayload := new(domain.UpdateProfileReq)
+
+	if err := c.BodyParser(reqPayload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    domain.ErrCodeValidation,
+		})
+	}
+
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		if fileHeader, err := c.FormFile("profilePic"); err == nil {
+			file, err := fileHeader.Open()
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid profile picture",
+					"code":    domain.ErrCodeInvalidProfile,
+				})
+			}
+			defer file.Close()
+			reqPayload.ProfilePic = file
+		}
+	}
+
+	user, err := h.userService.UpdateProfile(c.Context(), userID, *reqPayload)
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeInvalidProfile:
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			case domain.ErrCodeUsernameTaken:
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			case domain.ErrCodeAuthUserNotFound:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			default:
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Internal Server Error",
+					"code":    domainErr.Code,
+				})
+			}
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Profile updated successfully",
+		"data":    user,
+	})
+}
+
+func (h *Handlers) GetProfilePic(c *fiber.Ctx) error {
+	data, err := h.userService.GetProfilePic(c.Context(), c.Params("id"), c.Params("file"))
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeProfilePicNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	// File names are never reused, so the image can be cached indefinitely
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	c.Set(fiber.HeaderContentType, http.DetectContentType(data))
+	return c.Send(data)
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/thantko20/tubbym-backend/internal/auth"
@@ -12,28 +14,140 @@ import (
 type Handlers struct {
 	videoService services.VideoService
 	authService  auth.AuthService
+	userService  services.UserService
+	roleService  services.RoleService
 }
 
-func NewHandlers(videoService services.VideoService, authService auth.AuthService) *Handlers {
+func NewHandlers(videoService services.VideoService, authService auth.AuthService, userService services.UserService, roleService services.RoleService) *Handlers {
 	return &Handlers{
 		videoService: videoService,
 		authService:  authService,
+		userService:  userService,
+		roleService:  roleService,
 	}
 }
 
 func (h *Handlers) GetVideos(c *fiber.Ctx) error {
-	videos, count, err := h.videoService.GetVideos(c.Context(), nil)
+	return h.listVideos(c, "", h.currentUserID(c))
+}
+
+func (h *Handlers) GetUserVideos(c *fiber.Ctx) error {
+	return h.listVideos(c, c.Params("id"), h.currentUserID(c))
+}
+
+func (h *Handlers) GetMyVideos(c *fiber.Ctx) error {
+	session := h.currentSession(c)
+	if session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
+	return h.listVideos(c, session.User.ID, session.User.ID)
+}
+
+// listVideos lists the videos viewerID may see, filtered by the query
+// parameters. A non-empty owner overrides the owner query parameter.
+func (h *Handlers) listVideos(c *fiber.Ctx, owner string, viewerID string) error {
+	filters := new(domain.VideoFilters)
+
+	if err := c.QueryParser(filters); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid query parameters",
+			"code":    domain.ErrCodeValidation,
+		})
+	}
+	if owner != "" {
+		filters.UserID = owner
+	}
+	filters.ViewerID = viewerID
+
+	var err error
+	if filters.CreatedAfter, err = parseTimeQuery(c.Query("createdAfter")); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "createdAfter must be an RFC 3339 time or unix timestamp",
+			"code":    domain.ErrCodeInvalidVideoFilters,
+		})
+	}
+	if filters.CreatedBefore, err = parseTimeQuery(c.Query("createdBefore")); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "createdBefore must be an RFC 3339 time or unix timestamp",
+			"code":    domain.ErrCodeInvalidVideoFilters,
+		})
+	}
+
+	videos, count, err := h.videoService.GetVideos(c.Context(), filters)
 
 	var domainErr *domain.AppError
 	if errors.As(err, &domainErr) {
+		switch domainErr.Code {
+		case domain.ErrCodeInvalidVideoFilters:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Internal Server Error",
+				"code":    domainErr.Code,
+			})
+		}
+	}
+
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "Internal Server Error",
-			"code":    domainErr.Code,
+			"code":    9999,
 		})
 	}
 
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"message":    "Videos retrieved successfully",
+		"data":       videos,
+		"count":      count,
+		"nextCursor": filters.NextCursor(videos),
+	})
+}
+
+func (h *Handlers) SearchVideos(c *fiber.Ctx) error {
+	reqPayload := new(domain.VideoSearchReq)
+
+	if err := c.QueryParser(reqPayload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid query parameters",
+			"code":    domain.ErrCodeValidation,
+		})
+	}
+
+	results, count, err := h.videoService.SearchVideos(c.Context(), *reqPayload)
 	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeInvalidVideoFilters:
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			default:
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Internal Server Error",
+					"code":    domainErr.Code,
+				})
+			}
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "Internal Server Error",
@@ -44,13 +158,28 @@ func (h *Handlers) GetVideos(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Videos retrieved successfully",
-		"data":    videos,
+		"data":    results,
 		"count":   count,
 	})
 }
 
+// parseTimeQuery parses a query parameter given as RFC 3339 or unix seconds
+func parseTimeQuery(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 func (h *Handlers) GetVideoByID(c *fiber.Ctx) error {
 	video, err := h.videoService.GetVideoByID(c.Context(), c.Params("id"))
+	if err == nil && !h.canView(c, video) {
+		// Private and hidden videos are indistinguishable from missing ones to everyone who may not see them
+		err = domain.NewAppError(domain.ErrCodeVideoNotFound, "Video not found", nil)
+	}
 	if err != nil {
 		var domainErr *domain.AppError
 		if errors.As(err, &domainErr) {
@@ -84,6 +213,15 @@ func (h *Handlers) GetVideoByID(c *fiber.Ctx) error {
 }
 
 func (h *Handlers) CreateVideo(c *fiber.Ctx) error {
+	session := h.currentSession(c)
+	if session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Authentication required",
+			"code":    domain.ErrCodeAuthInvalidSession,
+		})
+	}
+
 	reqPayload := new(domain.CreateVideoReq)
 
 	if err := c.BodyParser(reqPayload); err != nil {
@@ -94,7 +232,9 @@ func (h *Handlers) CreateVideo(c *fiber.Ctx) error {
 		})
 	}
 
-	video, presignedUrl, err := h.videoService.CreateVideo(c.Context(), *reqPayload)
+	reqPayload.UserID = session.User.ID
+
+	video, upload, err := h.videoService.CreateVideo(c.Context(), *reqPayload)
 	if err != nil {
 		var domainErr *domain.AppError
 		if errors.As(err, &domainErr) {
@@ -125,24 +265,57 @@ func (h *Handlers) CreateVideo(c *fiber.Ctx) error {
 		"message": "Video created successfully",
 		"data": fiber.Map{
 			"videoId":      video.ID,
-			"presignedUrl": presignedUrl,
+			"uploadMode":   upload.Mode,
+			"presignedUrl": upload.PresignedURL,
+			"contentType":  upload.ContentType,
+			"partSize":     upload.PartSize,
+			"partCount":    upload.PartCount,
 		},
 	})
 }
 
 func (h *Handlers) ProcessVideo(c *fiber.Ctx) error {
-	videoId := c.Params("id")
-	err := h.videoService.ProcessVideo(c.Context(), videoId)
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	reqPayload := new(domain.ProcessVideoReq)
+
+	// The body is optional; without one the whole ladder is produced
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(reqPayload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request payload",
+				"code":    domain.ErrCodeValidation,
+			})
+		}
+	}
+	reqPayload.VideoID = c.Params("id")
+
+	err := h.videoService.ProcessVideo(c.Context(), *reqPayload)
 	if err != nil {
 		var domainErr *domain.AppError
 		if errors.As(err, &domainErr) {
 			switch domainErr.Code {
+			case domain.ErrCodeInvalidVideoData:
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
 			case domain.ErrCodeVideoNotFound:
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 					"success": false,
 					"message": domainErr.Message,
 					"code":    domainErr.Code,
 				})
+			case domain.ErrCodeVideoAlreadyProcessing, domain.ErrCodeVideoNotUploaded:
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
 			default:
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 					"success": false,
@@ -162,3 +335,245 @@ func (h *Handlers) ProcessVideo(c *fiber.Ctx) error {
 		"message": "Video processing started",
 	})
 }
+
+func (h *Handlers) CreateThumbnailUpload(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	key, presignedUrl, err := h.videoService.CreateThumbnailUpload(c.Context(), c.Params("id"))
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeVideoNotFound:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			default:
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Internal Server Error",
+					"code":    domainErr.Code,
+				})
+			}
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Thumbnail upload URL created successfully",
+		"data": fiber.Map{
+			"key":          key,
+			"presignedUrl": presignedUrl,
+		},
+	})
+}
+
+func (h *Handlers) ConfirmThumbnailUpload(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	reqPayload := new(domain.ConfirmThumbnailReq)
+
+	if err := c.BodyParser(reqPayload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    domain.ErrCodeValidation,
+		})
+	}
+
+	video, err := h.videoService.ConfirmThumbnailUpload(c.Context(), c.Params("id"), *reqPayload)
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeVideoNotFound:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			case domain.ErrCodeInvalidThumbnail:
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			default:
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Internal Server Error",
+					"code":    domainErr.Code,
+				})
+			}
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Thumbnail updated successfully",
+		"data":    video,
+	})
+}
+
+func (h *Handlers) ConfirmUpload(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	video, err := h.videoService.ConfirmUpload(c.Context(), c.Params("id"))
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) {
+			switch domainErr.Code {
+			case domain.ErrCodeVideoNotFound:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			case domain.ErrCodeVideoNotUploaded:
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			case domain.ErrCodeInvalidUpload:
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+					"success": false,
+					"message": domainErr.Message,
+					"code":    domainErr.Code,
+				})
+			default:
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Internal Server Error",
+					"code":    domainErr.Code,
+				})
+			}
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Internal Server Error",
+			"code":    9999,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Video upload confirmed",
+		"data":    video,
+	})
+}
+
+func (h *Handlers) UpdateVideo(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	reqPayload := new(domain.UpdateVideoReq)
+
+	if err := c.BodyParser(reqPayload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    domain.ErrCodeValidation,
+		})
+	}
+
+	video, err := h.videoService.UpdateVideo(c.Context(), c.Params("id"), *reqPayload)
+	if err != nil {
+		return videoError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Video updated successfully",
+		"data":    video,
+	})
+}
+
+// DeleteVideo soft deletes a video so it can still be restored
+func (h *Handlers) DeleteVideo(c *fiber.Ctx) error {
+	if ok, err := h.authorizeVideoOwner(c); !ok {
+		return err
+	}
+
+	if err := h.videoService.DeleteVideo(c.Context(), c.Params("id")); err != nil {
+		return videoError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Video deleted successfully",
+	})
+}
+
+func (h *Handlers) RestoreVideo(c *fiber.Ctx) error {
+	if ok, err := h.authorizeDeletedVideoOwner(c); !ok {
+		return err
+	}
+
+	video, err := h.videoService.RestoreVideo(c.Context(), c.Params("id"))
+	if err != nil {
+		return videoError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Video restored successfully",
+		"data":    video,
+	})
+}
+
+func videoError(c *fiber.Ctx, err error) error {
+	var domainErr *domain.AppError
+	if errors.As(err, &domainErr) {
+		switch domainErr.Code {
+		case domain.ErrCodeInvalidVideoData:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		case domain.ErrCodeVideoNotFound:
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		case domain.ErrCodeVideoPurging:
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": domainErr.Message,
+				"code":    domainErr.Code,
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Internal Server Error",
+				"code":    domainErr.Code,
+			})
+		}
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"message": "Internal Server Error",
+		"code":    9999,
+	})
+}
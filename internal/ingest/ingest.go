@@ -0,0 +1,82 @@
+// Package ingest turns storage notifications about new objects into events
+// the video service can act on.
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const EventObjectCreatedPut = "ObjectCreated:Put"
+
+// Event reports that an object was written to storage
+type Event struct {
+	// S3 event name, e.g. ObjectCreated:Put or ObjectCreated:CompleteMultipartUpload
+	Name   string
+	Bucket string
+	Key    string
+	Size   int64
+	ETag   string
+}
+
+// IsObjectCreated reports whether the event is one of the ObjectCreated family
+func (e Event) IsObjectCreated() bool {
+	return strings.HasPrefix(e.Name, "ObjectCreated:")
+}
+
+// Handler acts on a single event
+type Handler func(ctx context.Context, event Event) error
+
+// Source delivers events to a handler until ctx is cancelled. Implementations
+// can poll a queue, watch a filesystem or receive pushed notifications.
+type Source interface {
+	Run(ctx context.Context, handle Handler) error
+}
+
+type s3Notification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+				ETag string `json:"eTag"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// ParseS3Notification parses an S3 event notification, as sent to SQS and
+// webhooks or carried in the Message of an SNS notification. Test events and
+// other payloads without records yield no events.
+func ParseS3Notification(data []byte) ([]Event, error) {
+	var notification s3Notification
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return nil, fmt.Errorf("invalid notification: %w", err)
+	}
+
+	events := make([]Event, 0, len(notification.Records))
+	for _, record := range notification.Records {
+		// Keys arrive URL encoded, with spaces as '+'
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object key %q: %w", record.S3.Object.Key, err)
+		}
+
+		events = append(events, Event{
+			Name:   record.EventName,
+			Bucket: record.S3.Bucket.Name,
+			Key:    key,
+			Size:   record.S3.Object.Size,
+			ETag:   strings.Trim(record.S3.Object.ETag, `"`),
+		})
+	}
+
+	return events, nil
+}
@@ -0,0 +1,52 @@
+package ingest
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/storage"
+)
+
+// LocalSource emits ObjectCreated events for objects written to local
+// storage, so uploads are processed automatically without S3
+type LocalSource struct {
+	store  *storage.LocalStorage
+	events chan Event
+}
+
+func NewLocalSource(store *storage.LocalStorage) *LocalSource {
+	return &LocalSource{
+		store:  store,
+		events: make(chan Event, 100),
+	}
+}
+
+func (s *LocalSource) Run(ctx context.Context, handle Handler) error {
+	s.store.OnObjectCreated(func(key string, size int64) {
+		// Like the S3 notification setup, only raw uploads are of interest
+		if !strings.HasPrefix(key, domain.RawVideoPrefix) {
+			return
+		}
+
+		// Never hold up the write; a dropped upload can still be confirmed by the client
+		select {
+		case s.events <- Event{Name: EventObjectCreatedPut, Key: key, Size: size}:
+		default:
+			slog.Warn("dropped storage event, queue is full", "key", key)
+		}
+	})
+	defer s.store.OnObjectCreated(nil)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-s.events:
+			if err := handle(ctx, event); err != nil {
+				slog.Error("failed to handle storage event", "event", event.Name, "key", event.Key, "error", err)
+			}
+		}
+	}
+}
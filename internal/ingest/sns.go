@@ -0,0 +1,202 @@
+package ingest
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	SNSTypeNotification             = "Notification"
+	SNSTypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	SNSTypeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+var ErrInvalidSNSSignature = errors.New("invalid SNS message signature")
+
+// SNSMessage is a message delivered by an SNS topic's HTTP(S) subscription
+type SNSMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+}
+
+// ParseSNSMessage decodes data as an SNS message, returning nil when it isn't one
+func ParseSNSMessage(data []byte) (*SNSMessage, error) {
+	var message SNSMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, fmt.Errorf("invalid notification: %w", err)
+	}
+	if message.Type == "" {
+		return nil, nil
+	}
+	return &message, nil
+}
+
+// stringToSign builds the canonical form of the message SNS signs
+func (m *SNSMessage) stringToSign() string {
+	fields := [][2]string{{"Message", m.Message}, {"MessageId", m.MessageID}}
+	if m.Type == SNSTypeNotification {
+		if m.Subject != "" {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", m.Timestamp}, [2]string{"TopicArn", m.TopicArn})
+	} else {
+		fields = append(fields,
+			[2]string{"SubscribeURL", m.SubscribeURL},
+			[2]string{"Timestamp", m.Timestamp},
+			[2]string{"Token", m.Token},
+			[2]string{"TopicArn", m.TopicArn},
+		)
+	}
+	fields = append(fields, [2]string{"Type", m.Type})
+
+	var b strings.Builder
+	for _, field := range fields {
+		b.WriteString(field[0] + "\n" + field[1] + "\n")
+	}
+	return b.String()
+}
+
+var snsHostPattern = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SNSVerifier checks SNS message signatures against the signing certificates
+// SNS publishes, and confirms subscriptions
+type SNSVerifier struct {
+	client *http.Client
+	// allowHost reports whether certificates and subscribe URLs may be fetched from host
+	allowHost func(host string) bool
+
+	mu    sync.Mutex
+	certs map[string]*rsa.PublicKey
+}
+
+func NewSNSVerifier(client *http.Client) *SNSVerifier {
+	return &SNSVerifier{
+		client:    client,
+		allowHost: snsHostPattern.MatchString,
+		certs:     make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Verify checks that the message was signed by SNS
+func (v *SNSVerifier) Verify(ctx context.Context, message *SNSMessage) error {
+	var hash crypto.Hash
+	switch message.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("%w: unsupported signature version %q", ErrInvalidSNSSignature, message.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(message.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSNSSignature, err)
+	}
+
+	key, err := v.signingKey(ctx, message.SigningCertURL)
+	if err != nil {
+		return err
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(message.stringToSign()))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(message.stringToSign()))
+		digest = sum[:]
+	}
+
+	if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+		return ErrInvalidSNSSignature
+	}
+	return nil
+}
+
+// Confirm confirms the subscription a verified SubscriptionConfirmation message asks for
+func (v *SNSVerifier) Confirm(ctx context.Context, message *SNSMessage) error {
+	if _, err := v.get(ctx, message.SubscribeURL); err != nil {
+		return fmt.Errorf("failed to confirm subscription: %w", err)
+	}
+	return nil
+}
+
+func (v *SNSVerifier) signingKey(ctx context.Context, certURL string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.certs[certURL]
+	v.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	data, err := v.get(ctx, certURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: signing certificate is not PEM encoded", ErrInvalidSNSSignature)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSNSSignature, err)
+	}
+	key, ok = cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: signing certificate has no RSA key", ErrInvalidSNSSignature)
+	}
+
+	v.mu.Lock()
+	v.certs[certURL] = key
+	v.mu.Unlock()
+	return key, nil
+}
+
+// get fetches rawURL, refusing anything but HTTPS URLs on SNS hosts
+func (v *SNSVerifier) get(ctx context.Context, rawURL string) ([]byte, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "https" || !v.allowHost(parsed.Hostname()) {
+		return nil, fmt.Errorf("%w: untrusted URL %q", ErrInvalidSNSSignature, rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, parsed.Host)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,213 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	pollInterval      = 2 * time.Second
+	heartbeatInterval = 10 * time.Second
+	staleAfter        = 3 * heartbeatInterval
+)
+
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// FailedFunc is called for a job that failed without its handler seeing the
+// failure, because its worker stopped responding on the last attempt
+type FailedFunc func(ctx context.Context, job *Job)
+
+// Pool runs a fixed number of workers that claim jobs from the queue and
+// dispatch them to the handler registered for their type
+type Pool struct {
+	queue    Queue
+	workers  int
+	handlers map[string]HandlerFunc
+	onFailed map[string]FailedFunc
+	wg       sync.WaitGroup
+}
+
+func NewPool(queue Queue, workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Pool{
+		queue:    queue,
+		workers:  workers,
+		handlers: make(map[string]HandlerFunc),
+		onFailed: make(map[string]FailedFunc),
+	}
+}
+
+// Register sets the handler for a job type. It must be called before Start.
+func (p *Pool) Register(jobType string, handler HandlerFunc) {
+	p.handlers[jobType] = handler
+}
+
+// OnFailed sets the function called when a job of jobType is abandoned on its
+// last attempt. It must be called before Start.
+func (p *Pool) OnFailed(jobType string, fn FailedFunc) {
+	p.onFailed[jobType] = fn
+}
+
+// Start re-queues jobs abandoned by a previous run and starts the workers,
+// which stop once ctx is cancelled
+func (p *Pool) Start(ctx context.Context) error {
+	if err := p.requeueStale(ctx); err != nil {
+		return fmt.Errorf("failed to requeue stale jobs: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	for i := 0; i < p.workers; i++ {
+		workerID := fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8])
+		p.wg.Add(1)
+		go p.work(ctx, workerID)
+	}
+
+	p.wg.Add(1)
+	go p.reapStale(ctx)
+
+	return nil
+}
+
+// Wait blocks until all workers have stopped
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Pool) work(ctx context.Context, workerID string) {
+	defer p.wg.Done()
+
+	for {
+		job, err := p.queue.Claim(ctx, workerID)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("failed to claim job", "worker", workerID, "error", err)
+		}
+
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+				continue
+			}
+		}
+
+		p.run(ctx, workerID, job)
+	}
+}
+
+func (p *Pool) run(ctx context.Context, workerID string, job *Job) {
+	handler, ok := p.handlers[job.Type]
+	if !ok {
+		slog.Error("no handler registered for job type", "jobId", job.ID, "type", job.Type)
+		if err := p.queue.Fail(context.Background(), job, workerID, Permanent(fmt.Errorf("unknown job type %q", job.Type))); err != nil {
+			slog.Error("failed to mark job as failed", "jobId", job.ID, "error", err)
+		}
+		return
+	}
+
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go p.heartbeat(jobCtx, cancel, workerID, job.ID)
+
+	slog.Info("running job", "jobId", job.ID, "type", job.Type, "attempt", job.Attempts, "worker", workerID)
+	err := p.safeRun(jobCtx, handler, job)
+	cancel(nil)
+
+	switch {
+	case errors.Is(context.Cause(jobCtx), ErrLockLost):
+		// Another worker owns the job now, so leave its row alone
+		slog.Warn("job was requeued while running, abandoning it", "jobId", job.ID, "worker", workerID)
+	case err == nil:
+		if err := p.queue.Complete(context.Background(), job.ID, workerID); err != nil {
+			slog.Error("failed to mark job as completed", "jobId", job.ID, "error", err)
+		}
+	case ctx.Err() != nil:
+		// Shutting down: hand the job back so the next run picks it up
+		slog.Info("releasing job on shutdown", "jobId", job.ID)
+		if err := p.queue.Release(context.Background(), job.ID, workerID); err != nil {
+			slog.Error("failed to release job", "jobId", job.ID, "error", err)
+		}
+	default:
+		slog.Error("job failed", "jobId", job.ID, "type", job.Type, "attempt", job.Attempts, "error", err)
+		if err := p.queue.Fail(context.Background(), job, workerID, err); err != nil {
+			slog.Error("failed to record job failure", "jobId", job.ID, "error", err)
+		}
+	}
+}
+
+func (p *Pool) safeRun(ctx context.Context, handler HandlerFunc, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// heartbeat keeps the job's lock fresh, cancelling the job with ErrLockLost
+// once it has been handed to another worker
+func (p *Pool) heartbeat(ctx context.Context, cancel context.CancelCauseFunc, workerID string, jobID string) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := p.queue.Heartbeat(ctx, jobID, workerID)
+			if errors.Is(err, ErrLockLost) {
+				cancel(ErrLockLost)
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				slog.Error("failed to send job heartbeat", "jobId", jobID, "error", err)
+			}
+		}
+	}
+}
+
+// reapStale periodically re-queues jobs held by workers that stopped heartbeating
+func (p *Pool) reapStale(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(staleAfter)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.requeueStale(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("failed to requeue stale jobs", "error", err)
+			}
+		}
+	}
+}
+
+// requeueStale re-queues abandoned jobs and hands those out of attempts to
+// the OnFailed function for their type
+func (p *Pool) requeueStale(ctx context.Context) error {
+	n, failed, err := p.queue.RequeueStale(ctx, staleAfter)
+	if n > 0 {
+		slog.Info("requeued stale jobs", "count", n)
+	}
+	for _, job := range failed {
+		slog.Error("job failed after its worker stopped responding", "jobId", job.ID, "type", job.Type, "attempt", job.Attempts)
+		if onFailed, ok := p.onFailed[job.Type]; ok {
+			onFailed(ctx, job)
+		}
+	}
+	return err
+}
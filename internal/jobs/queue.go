@@ -0,0 +1,297 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxAttempts = 5
+	baseRetryDelay     = 30 * time.Second
+	maxRetryDelay      = 30 * time.Minute
+)
+
+// ErrLockLost is returned when a worker updates a job it no longer holds,
+// because the job was requeued after its heartbeats stopped
+var ErrLockLost = errors.New("job lock was lost")
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+type Job struct {
+	ID          string          `json:"id" db:"id"`
+	Type        string          `json:"type" db:"type"`
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	Status      Status          `json:"status" db:"status"`
+	Attempts    int             `json:"attempts" db:"attempts"`
+	MaxAttempts int             `json:"maxAttempts" db:"max_attempts"`
+	RunAt       time.Time       `json:"runAt" db:"run_at"`
+	LastError   string          `json:"lastError" db:"last_error"`
+	CreatedAt   time.Time       `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time       `json:"updatedAt" db:"updated_at"`
+}
+
+// IsLastAttempt reports whether a failure of the current attempt will not be retried
+func (j *Job) IsLastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// permanentError marks a job failure that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so the queue fails the job without retrying it
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+type Queue interface {
+	Enqueue(ctx context.Context, jobType string, payload any) (*Job, error)
+	// EnqueueTx enqueues the job as part of tx, so it is only queued if tx commits
+	EnqueueTx(ctx context.Context, tx *sql.Tx, jobType string, payload any) (*Job, error)
+	// Claim locks the next due job for workerID, returning nil when there is none
+	Claim(ctx context.Context, workerID string) (*Job, error)
+	// Heartbeat, Complete, Fail and Release only act on jobs workerID still
+	// holds, returning ErrLockLost otherwise
+	Heartbeat(ctx context.Context, id string, workerID string) error
+	Complete(ctx context.Context, id string, workerID string) error
+	// Fail records the error and schedules a retry with backoff, or marks the
+	// job failed once it is out of attempts or the error is permanent
+	Fail(ctx context.Context, job *Job, workerID string, jobErr error) error
+	// Release puts a running job back on the queue without counting the attempt
+	Release(ctx context.Context, id string, workerID string) error
+	// RequeueStale re-queues running jobs whose worker stopped sending
+	// heartbeats. Those already out of attempts are marked failed instead and returned.
+	RequeueStale(ctx context.Context, staleAfter time.Duration) (int64, []*Job, error)
+}
+
+type sqliteQueue struct {
+	db *sql.DB
+}
+
+func NewQueue(db *sql.DB) Queue {
+	return &sqliteQueue{db: db}
+}
+
+func (q *sqliteQueue) Enqueue(ctx context.Context, jobType string, payload any) (*Job, error) {
+	return q.enqueue(ctx, q.db, jobType, payload)
+}
+
+func (q *sqliteQueue) EnqueueTx(ctx context.Context, tx *sql.Tx, jobType string, payload any) (*Job, error) {
+	return q.enqueue(ctx, tx, jobType, payload)
+}
+
+func (q *sqliteQueue) enqueue(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, jobType string, payload any) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:          uuid.New().String(),
+		Type:        jobType,
+		Payload:     data,
+		Status:      StatusQueued,
+		MaxAttempts: defaultMaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	query := `
+		INSERT INTO jobs (id, type, payload, status, attempts, max_attempts, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = db.ExecContext(ctx, query,
+		job.ID, job.Type, string(job.Payload), job.Status, job.Attempts, job.MaxAttempts,
+		job.RunAt.Unix(), job.CreatedAt.Unix(), job.UpdatedAt.Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (q *sqliteQueue) Claim(ctx context.Context, workerID string) (*Job, error) {
+	now := time.Now().Unix()
+
+	query := `
+		UPDATE jobs
+		SET status = ?, attempts = attempts + 1, locked_by = ?, heartbeat_at = ?, updated_at = ?
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_at <= ?
+			ORDER BY run_at, created_at
+			LIMIT 1
+		)
+		RETURNING id, type, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at`
+
+	row := q.db.QueryRowContext(ctx, query, StatusRunning, workerID, now, now, StatusQueued, now)
+
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// scanJob reads a job from the columns the queue's RETURNING clauses select
+func scanJob(row interface{ Scan(dest ...any) error }) (*Job, error) {
+	var job Job
+	var payload string
+	var lastError sql.NullString
+	var runAt, createdAt, updatedAt int64
+
+	err := row.Scan(&job.ID, &job.Type, &payload, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&runAt, &lastError, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Payload = json.RawMessage(payload)
+	job.LastError = lastError.String
+	job.RunAt = time.Unix(runAt, 0)
+	job.CreatedAt = time.Unix(createdAt, 0)
+	job.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &job, nil
+}
+
+func (q *sqliteQueue) Heartbeat(ctx context.Context, id string, workerID string) error {
+	now := time.Now().Unix()
+	res, err := q.db.ExecContext(ctx,
+		`UPDATE jobs SET heartbeat_at = ?, updated_at = ? WHERE id = ? AND locked_by = ? AND status = ?`,
+		now, now, id, workerID, StatusRunning)
+	return lockHeld(res, err)
+}
+
+func (q *sqliteQueue) Complete(ctx context.Context, id string, workerID string) error {
+	res, err := q.db.ExecContext(ctx,
+		`UPDATE jobs SET status = ?, locked_by = NULL, heartbeat_at = NULL, updated_at = ?
+		WHERE id = ? AND locked_by = ? AND status = ?`,
+		StatusCompleted, time.Now().Unix(), id, workerID, StatusRunning)
+	return lockHeld(res, err)
+}
+
+func (q *sqliteQueue) Fail(ctx context.Context, job *Job, workerID string, jobErr error) error {
+	now := time.Now()
+
+	if job.IsLastAttempt() || IsPermanent(jobErr) {
+		res, err := q.db.ExecContext(ctx,
+			`UPDATE jobs SET status = ?, last_error = ?, locked_by = NULL, heartbeat_at = NULL, updated_at = ?
+			WHERE id = ? AND locked_by = ? AND status = ?`,
+			StatusFailed, jobErr.Error(), now.Unix(), job.ID, workerID, StatusRunning)
+		return lockHeld(res, err)
+	}
+
+	runAt := now.Add(retryDelay(job.Attempts))
+	res, err := q.db.ExecContext(ctx,
+		`UPDATE jobs SET status = ?, run_at = ?, last_error = ?, locked_by = NULL, heartbeat_at = NULL, updated_at = ?
+		WHERE id = ? AND locked_by = ? AND status = ?`,
+		StatusQueued, runAt.Unix(), jobErr.Error(), now.Unix(), job.ID, workerID, StatusRunning)
+	return lockHeld(res, err)
+}
+
+func (q *sqliteQueue) Release(ctx context.Context, id string, workerID string) error {
+	res, err := q.db.ExecContext(ctx,
+		`UPDATE jobs SET status = ?, attempts = MAX(attempts - 1, 0), locked_by = NULL, heartbeat_at = NULL, updated_at = ?
+		WHERE id = ? AND locked_by = ? AND status = ?`,
+		StatusQueued, time.Now().Unix(), id, workerID, StatusRunning)
+	return lockHeld(res, err)
+}
+
+func (q *sqliteQueue) RequeueStale(ctx context.Context, staleAfter time.Duration) (int64, []*Job, error) {
+	now := time.Now()
+	staleBefore := now.Add(-staleAfter).Unix()
+
+	// A job that keeps taking its worker down with it would otherwise be
+	// reclaimed forever, so stop once it has used up its attempts
+	rows, err := q.db.QueryContext(ctx,
+		`UPDATE jobs SET status = ?, last_error = ?, locked_by = NULL, heartbeat_at = NULL, updated_at = ?
+		WHERE status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?) AND attempts >= max_attempts
+		RETURNING id, type, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at`,
+		StatusFailed, "worker stopped responding on the last attempt", now.Unix(), StatusRunning, staleBefore)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var failed []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return 0, nil, err
+		}
+		failed = append(failed, job)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	res, err := q.db.ExecContext(ctx,
+		`UPDATE jobs SET status = ?, run_at = ?, locked_by = NULL, heartbeat_at = NULL, updated_at = ?
+		WHERE status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?) AND attempts < max_attempts`,
+		StatusQueued, now.Unix(), now.Unix(), StatusRunning, staleBefore)
+	if err != nil {
+		return 0, failed, err
+	}
+	n, err := res.RowsAffected()
+	return n, failed, err
+}
+
+// lockHeld turns an update that matched no rows into ErrLockLost
+func lockHeld(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// retryDelay returns an exponential backoff for the given attempt number
+func retryDelay(attempt int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestQueue(t *testing.T) (*sqliteQueue, *sql.DB) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	data, err := os.ReadFile("../db/migrations/20250915083012_add_jobs_table.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	up, _, _ := strings.Cut(string(data), "-- +goose Down")
+	if _, err := db.Exec(up); err != nil {
+		t.Fatalf("apply migration: %v", err)
+	}
+
+	return NewQueue(db).(*sqliteQueue), db
+}
+
+// claimStale enqueues a job, claims it for worker and makes its heartbeat stale
+func claimStale(t *testing.T, q *sqliteQueue, db *sql.DB, worker string) *Job {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := q.Enqueue(ctx, "test", nil); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	job, err := q.Claim(ctx, worker)
+	if err != nil || job == nil {
+		t.Fatalf("Claim = %v, %v", job, err)
+	}
+	if _, err := db.Exec(`UPDATE jobs SET heartbeat_at = 0 WHERE id = ?`, job.ID); err != nil {
+		t.Fatalf("age heartbeat: %v", err)
+	}
+	return job
+}
+
+func TestQueueRejectsUpdatesFromWorkerThatLostLock(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+
+	job := claimStale(t, q, db, "worker-1")
+	if n, _, err := q.RequeueStale(ctx, time.Minute); err != nil || n != 1 {
+		t.Fatalf("RequeueStale = %d, %v; want 1 requeued", n, err)
+	}
+	reclaimed, err := q.Claim(ctx, "worker-2")
+	if err != nil || reclaimed == nil || reclaimed.ID != job.ID {
+		t.Fatalf("Claim = %v, %v; want the requeued job", reclaimed, err)
+	}
+
+	if err := q.Heartbeat(ctx, job.ID, "worker-1"); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Heartbeat: got %v, want ErrLockLost", err)
+	}
+	if err := q.Complete(ctx, job.ID, "worker-1"); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Complete: got %v, want ErrLockLost", err)
+	}
+	if err := q.Fail(ctx, job, "worker-1", errors.New("boom")); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Fail: got %v, want ErrLockLost", err)
+	}
+	if err := q.Release(ctx, job.ID, "worker-1"); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Release: got %v, want ErrLockLost", err)
+	}
+
+	var status Status
+	var lockedBy string
+	if err := db.QueryRow(`SELECT status, locked_by FROM jobs WHERE id = ?`, job.ID).Scan(&status, &lockedBy); err != nil {
+		t.Fatalf("load job: %v", err)
+	}
+	if status != StatusRunning || lockedBy != "worker-2" {
+		t.Errorf("job is %s by %s, want still running by worker-2", status, lockedBy)
+	}
+
+	if err := q.Heartbeat(ctx, job.ID, "worker-2"); err != nil {
+		t.Errorf("Heartbeat from the new owner: %v", err)
+	}
+	if err := q.Complete(ctx, job.ID, "worker-2"); err != nil {
+		t.Errorf("Complete from the new owner: %v", err)
+	}
+}
+
+func TestRequeueStaleFailsJobsOutOfAttempts(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+
+	retried := claimStale(t, q, db, "worker-1")
+	exhausted := claimStale(t, q, db, "worker-1")
+	if _, err := db.Exec(`UPDATE jobs SET attempts = max_attempts WHERE id = ?`, exhausted.ID); err != nil {
+		t.Fatalf("use up attempts: %v", err)
+	}
+
+	n, failed, err := q.RequeueStale(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("RequeueStale: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("requeued %d jobs, want 1", n)
+	}
+	if len(failed) != 1 || failed[0].ID != exhausted.ID || failed[0].Status != StatusFailed {
+		t.Fatalf("failed jobs = %+v, want only %s", failed, exhausted.ID)
+	}
+
+	for id, want := range map[string]Status{retried.ID: StatusQueued, exhausted.ID: StatusFailed} {
+		var status Status
+		if err := db.QueryRow(`SELECT status FROM jobs WHERE id = ?`, id).Scan(&status); err != nil {
+			t.Fatalf("load job: %v", err)
+		}
+		if status != want {
+			t.Errorf("job %s is %s, want %s", id, status, want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Mailer sends transactional email such as verification and password reset links
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// LogMailer writes emails to the log instead of sending them, for development.
+// Bodies carry sign-in links, so they are only logged when logBody is set.
+type LogMailer struct {
+	logBody bool
+}
+
+func NewLogMailer(logBody bool) *LogMailer {
+	return &LogMailer{logBody: logBody}
+}
+
+func (m *LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	if !m.logBody {
+		slog.Warn("Email not sent, no mailer is configured", "to", to, "subject", subject)
+		return nil
+	}
+	slog.Info("Sending email", "to", to, "subject", subject, "body", body)
+	return nil
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/auth"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+const (
+	SessionCookieName = "t_session_id"
+	// Locals key the validated *domain.ValidateSessionDTO is stored under
+	LocalsSessionKey = "session"
+
+	maxUserAgentLength = 512
+)
+
+// RequireAuth rejects requests without a valid session with 401 and stores
+// the session in Locals for the handlers that follow
+func RequireAuth(authService auth.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := SessionToken(c)
+		if token == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": "Authentication required",
+				"code":    domain.ErrCodeAuthInvalidSession,
+			})
+		}
+
+		session, appErr := authenticate(c, authService, token)
+		if appErr != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"message": appErr.Message,
+				"code":    appErr.Code,
+			})
+		}
+
+		c.Locals(LocalsSessionKey, session)
+		return c.Next()
+	}
+}
+
+// OptionalAuth stores the session in Locals when the request carries a valid
+// one, and otherwise lets the request through anonymously
+func OptionalAuth(authService auth.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token := SessionToken(c); token != "" {
+			if session, appErr := authenticate(c, authService, token); appErr == nil {
+				c.Locals(LocalsSessionKey, session)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// authenticate validates the session or API token and records the request's
+// activity on the session. Sessions signed in with the cookie get their token
+// rotated from time to time, and the new one is set as the cookie.
+func authenticate(c *fiber.Ctx, authService auth.AuthService, token string) (*domain.ValidateSessionDTO, *domain.AppError) {
+	if strings.HasPrefix(token, domain.APITokenPrefix) {
+		return authService.ValidateAPIToken(c.Context(), token)
+	}
+
+	session, appErr := authService.ValidateSession(token)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	fromCookie := c.Cookies(SessionCookieName) == token
+	newToken, err := authService.RefreshSession(c.Context(), &session.Session, ClientInfo(c), fromCookie)
+	if err != nil {
+		// The session is still valid, so don't fail the request over it
+		slog.Error("Failed to refresh session", "sessionId", session.Session.ID, "error", err)
+	}
+	if newToken != "" {
+		rotated := session.Session
+		rotated.Token = newToken
+		SetSessionCookie(c, &rotated)
+	}
+
+	return session, nil
+}
+
+// SetSessionCookie signs the browser in with session
+func SetSessionCookie(c *fiber.Ctx, session *domain.Session) {
+	cookie := new(fiber.Cookie)
+	cookie.Name = SessionCookieName
+	cookie.Value = session.Token
+	// Sessions slide their expiry as they are used, so the cookie lasts as long
+	// as the session possibly can and the server decides when it ends
+	cookie.Expires = session.CreatedAt.Add(auth.SessionMaxLifetime)
+	cookie.HTTPOnly = true
+	cookie.SameSite = "Lax"
+
+	c.Cookie(cookie)
+}
+
+// ClientInfo describes the client the request came from
+func ClientInfo(c *fiber.Ctx) domain.ClientInfo {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return domain.ClientInfo{
+		UserAgent: userAgent,
+		IPAddress: c.IP(),
+	}
+}
+
+// RequireScope rejects requests made with an API token that wasn't granted
+// scope with 403. Sessions and anonymous requests pass through, so it goes
+// after RequireAuth or OptionalAuth.
+func RequireScope(scope domain.Scope) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if session := Session(c); session != nil && !session.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": "API token is missing the " + string(scope) + " scope",
+				"code":    domain.ErrCodeInsufficientScope,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// RequireSession rejects requests made with an API token with 403, for
+// account management that tokens must never be able to do. It goes after RequireAuth.
+func RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if session := Session(c); session != nil && session.APIToken != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"message": "This endpoint requires signing in; API tokens can't be used",
+				"code":    domain.ErrCodeInsufficientScope,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// Session returns the session stored by RequireAuth or OptionalAuth, or nil
+// for anonymous requests
+func Session(c *fiber.Ctx) *domain.ValidateSessionDTO {
+	session, _ := c.Locals(LocalsSessionKey).(*domain.ValidateSessionDTO)
+	return session
+}
+
+// SessionToken reads the session or API token from an Authorization: Bearer header,
+// falling back to the session cookie
+func SessionToken(c *fiber.Ctx) string {
+	if header := c.Get(fiber.HeaderAuthorization); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return c.Cookies(SessionCookieName)
+}
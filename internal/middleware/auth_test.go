@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// newScopedApp serves GET / behind guard, as the given session
+func newScopedApp(session *domain.ValidateSessionDTO, guard fiber.Handler) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if session != nil {
+			c.Locals(LocalsSessionKey, session)
+		}
+		return c.Next()
+	})
+	app.Get("/", guard, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func status(t *testing.T, app *fiber.App) int {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRequireScope(t *testing.T) {
+	readOnly := &domain.ValidateSessionDTO{APIToken: &domain.APIToken{Scopes: []domain.Scope{domain.ScopeVideosRead}}}
+
+	tests := []struct {
+		name    string
+		session *domain.ValidateSessionDTO
+		scope   domain.Scope
+		want    int
+	}{
+		{"anonymous", nil, domain.ScopeVideosWrite, fiber.StatusOK},
+		{"session", &domain.ValidateSessionDTO{}, domain.ScopeVideosWrite, fiber.StatusOK},
+		{"token with scope", readOnly, domain.ScopeVideosRead, fiber.StatusOK},
+		{"token without scope", readOnly, domain.ScopeVideosWrite, fiber.StatusForbidden},
+		{"token without any scope", &domain.ValidateSessionDTO{APIToken: &domain.APIToken{}}, domain.ScopeProfileRead, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status(t, newScopedApp(tt.session, RequireScope(tt.scope))); got != tt.want {
+				t.Errorf("got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	allScopes := &domain.ValidateSessionDTO{APIToken: &domain.APIToken{Scopes: domain.Scopes}}
+
+	if got := status(t, newScopedApp(&domain.ValidateSessionDTO{}, RequireSession())); got != fiber.StatusOK {
+		t.Errorf("session: got status %d, want %d", got, fiber.StatusOK)
+	}
+	if got := status(t, newScopedApp(allScopes, RequireSession())); got != fiber.StatusForbidden {
+		t.Errorf("API token with every scope: got status %d, want %d", got, fiber.StatusForbidden)
+	}
+}
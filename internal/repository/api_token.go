@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+type APITokenRepository interface {
+	Create(ctx context.Context, token *domain.APIToken) error
+	// FindByTokenWithUser finds the unrevoked, unexpired token with tokenHash and its user
+	FindByTokenWithUser(ctx context.Context, tokenHash string) (*domain.APIToken, *domain.User, error)
+	// ListByUserID returns the user's unrevoked tokens, newest first, including expired ones
+	ListByUserID(ctx context.Context, userID string) ([]domain.APIToken, error)
+	MarkUsed(ctx context.Context, id string, usedAt time.Time) error
+	// Revoke revokes one of the user's tokens, returning sql.ErrNoRows when it has none with id
+	Revoke(ctx context.Context, userID string, id string) error
+}
+
+type apiTokenRepository struct {
+	db *sql.DB
+}
+
+func NewAPITokenRepository(db *sql.DB) APITokenRepository {
+	return &apiTokenRepository{db: db}
+}
+
+// apiTokenColumns are the columns scanAPIToken reads, in order
+const apiTokenColumns = `t.id, t.user_id, t.name, t.token_hash, t.prefix, t.scopes,
+	t.expires_at, t.last_used_at, t.created_at, t.revoked_at`
+
+// scanAPIToken scans apiTokenColumns into a token, followed by any extra destinations
+func scanAPIToken(row interface{ Scan(...any) error }, extra ...any) (*domain.APIToken, error) {
+	var token domain.APIToken
+	var scopes string
+	var expiresAt, createdAt int64
+	var lastUsedAt, revokedAt sql.NullInt64
+
+	dest := []any{
+		&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Prefix, &scopes,
+		&expiresAt, &lastUsedAt, &createdAt, &revokedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	for _, scope := range strings.Fields(scopes) {
+		token.Scopes = append(token.Scopes, domain.Scope(scope))
+	}
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+	token.CreatedAt = time.Unix(createdAt, 0)
+	if lastUsedAt.Valid {
+		usedTime := time.Unix(lastUsedAt.Int64, 0)
+		token.LastUsedAt = &usedTime
+	}
+	if revokedAt.Valid {
+		revokedTime := time.Unix(revokedAt.Int64, 0)
+		token.RevokedAt = &revokedTime
+	}
+
+	return &token, nil
+}
+
+func (r *apiTokenRepository) Create(ctx context.Context, token *domain.APIToken) error {
+	query := `
+		INSERT INTO api_tokens (id, user_id, name, token_hash, prefix, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	scopes := make([]string, len(token.Scopes))
+	for i, scope := range token.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	_, err := r.db.ExecContext(ctx, query,
+		token.ID, token.UserID, token.Name, token.TokenHash, token.Prefix, strings.Join(scopes, " "),
+		token.ExpiresAt.Unix(), token.CreatedAt.Unix(),
+	)
+	return err
+}
+
+func (r *apiTokenRepository) FindByTokenWithUser(ctx context.Context, tokenHash string) (*domain.APIToken, *domain.User, error) {
+	query := `
+		SELECT
+			` + apiTokenColumns + `,
+			u.id, u.name, u.email, u.username, u.profile_pic, u.created_at, u.updated_at
+		FROM api_tokens t
+		JOIN users u ON t.user_id = u.id
+		WHERE t.token_hash = ? AND t.revoked_at IS NULL AND t.expires_at > ? AND u.deleted_at IS NULL`
+
+	var user domain.User
+	var profilePic sql.NullString
+	var userCreatedAt, userUpdatedAt int64
+
+	token, err := scanAPIToken(r.db.QueryRowContext(ctx, query, tokenHash, time.Now().Unix()),
+		&user.ID, &user.Name, &user.Email, &user.Username, &profilePic, &userCreatedAt, &userUpdatedAt,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user.ProfilePic = profilePic.String
+	user.CreatedAt = time.Unix(userCreatedAt, 0)
+	user.UpdatedAt = time.Unix(userUpdatedAt, 0)
+
+	return token, &user, nil
+}
+
+func (r *apiTokenRepository) ListByUserID(ctx context.Context, userID string) ([]domain.APIToken, error) {
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM api_tokens t
+		WHERE t.user_id = ? AND t.revoked_at IS NULL
+		ORDER BY t.created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []domain.APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (r *apiTokenRepository) MarkUsed(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, usedAt.Unix(), id)
+	return err
+}
+
+func (r *apiTokenRepository) Revoke(ctx context.Context, userID string, id string) error {
+	query := `
+		UPDATE api_tokens
+		SET revoked_at = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().Unix(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+type AuthTokenRepository interface {
+	// Create stores the token, invalidating the user's unused tokens with the same purpose
+	Create(ctx context.Context, token *domain.AuthToken) error
+	// Consume marks an unused, unexpired token as used and returns it, or sql.ErrNoRows
+	Consume(ctx context.Context, tokenHash string, purpose domain.AuthTokenPurpose) (*domain.AuthToken, error)
+}
+
+type authTokenRepository struct {
+	db *sql.DB
+}
+
+func NewAuthTokenRepository(db *sql.DB) AuthTokenRepository {
+	return &authTokenRepository{db: db}
+}
+
+func (r *authTokenRepository) Create(ctx context.Context, token *domain.AuthToken) error {
+	_, err := r.db.ExecContext(ctx,
+		`DELETE FROM auth_tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL`,
+		token.UserID, token.Purpose)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO auth_tokens (token_hash, user_id, purpose, expires_at, created_at) 
+		VALUES (?, ?, ?, ?, ?)`
+
+	_, err = r.db.ExecContext(ctx, query,
+		token.TokenHash, token.UserID, token.Purpose, token.ExpiresAt.Unix(), token.CreatedAt.Unix(),
+	)
+	return err
+}
+
+func (r *authTokenRepository) Consume(ctx context.Context, tokenHash string, purpose domain.AuthTokenPurpose) (*domain.AuthToken, error) {
+	query := `
+		UPDATE auth_tokens 
+		SET used_at = ? 
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ? 
+		RETURNING token_hash, user_id, purpose, expires_at, used_at, created_at`
+
+	now := time.Now()
+
+	var token domain.AuthToken
+	var expiresAt, usedAt, createdAt int64
+
+	err := r.db.QueryRowContext(ctx, query, now.Unix(), tokenHash, purpose, now.Unix()).Scan(
+		&token.TokenHash, &token.UserID, &token.Purpose, &expiresAt, &usedAt, &createdAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+	usedTime := time.Unix(usedAt, 0)
+	token.UsedAt = &usedTime
+	token.CreatedAt = time.Unix(createdAt, 0)
+
+	return &token, nil
+}
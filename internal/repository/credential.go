@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+type CredentialRepository interface {
+	FindByUserID(ctx context.Context, userID string) (*domain.Credential, error)
+	Create(ctx context.Context, credential *domain.Credential) error
+	// CreateTx creates the credential as part of tx
+	CreateTx(ctx context.Context, tx *sql.Tx, credential *domain.Credential) error
+	// SetPassword replaces the password hash, creating the credential when the user has none,
+	// and clears any lockout
+	SetPassword(ctx context.Context, userID string, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, userID string) error
+	// RecordFailure counts a failed login and locks the credential until lockUntil once
+	// maxAttempts consecutive failures are reached. It reports whether the credential is now locked.
+	RecordFailure(ctx context.Context, userID string, maxAttempts int, lockUntil time.Time) (bool, error)
+	ResetFailures(ctx context.Context, userID string) error
+	// DeleteUnverified removes the user's credential if its email was never verified
+	DeleteUnverified(ctx context.Context, userID string) error
+}
+
+type credentialRepository struct {
+	db *sql.DB
+}
+
+func NewCredentialRepository(db *sql.DB) CredentialRepository {
+	return &credentialRepository{db: db}
+}
+
+func (r *credentialRepository) FindByUserID(ctx context.Context, userID string) (*domain.Credential, error) {
+	query := `
+		SELECT user_id, password_hash, email_verified_at, failed_attempts, locked_until, created_at, updated_at 
+		FROM credentials 
+		WHERE user_id = ?`
+
+	var credential domain.Credential
+	var emailVerifiedAt, lockedUntil sql.NullInt64
+	var createdAt, updatedAt int64
+
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&credential.UserID, &credential.PasswordHash, &emailVerifiedAt,
+		&credential.FailedAttempts, &lockedUntil, &createdAt, &updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if emailVerifiedAt.Valid {
+		verifiedTime := time.Unix(emailVerifiedAt.Int64, 0)
+		credential.EmailVerifiedAt = &verifiedTime
+	}
+	if lockedUntil.Valid {
+		lockedTime := time.Unix(lockedUntil.Int64, 0)
+		credential.LockedUntil = &lockedTime
+	}
+	credential.CreatedAt = time.Unix(createdAt, 0)
+	credential.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &credential, nil
+}
+
+func (r *credentialRepository) Create(ctx context.Context, credential *domain.Credential) error {
+	return r.create(ctx, r.db, credential)
+}
+
+func (r *credentialRepository) CreateTx(ctx context.Context, tx *sql.Tx, credential *domain.Credential) error {
+	return r.create(ctx, tx, credential)
+}
+
+func (r *credentialRepository) create(ctx context.Context, db execer, credential *domain.Credential) error {
+	query := `
+		INSERT INTO credentials (user_id, password_hash, created_at, updated_at) 
+		VALUES (?, ?, ?, ?)`
+
+	_, err := db.ExecContext(ctx, query,
+		credential.UserID, credential.PasswordHash, credential.CreatedAt.Unix(), credential.UpdatedAt.Unix(),
+	)
+	return err
+}
+
+func (r *credentialRepository) SetPassword(ctx context.Context, userID string, passwordHash string) error {
+	query := `
+		INSERT INTO credentials (user_id, password_hash, created_at, updated_at) 
+		VALUES (?, ?, ?, ?) 
+		ON CONFLICT (user_id) DO UPDATE 
+		SET password_hash = excluded.password_hash, failed_attempts = 0, locked_until = NULL, updated_at = excluded.updated_at`
+
+	now := time.Now().Unix()
+	_, err := r.db.ExecContext(ctx, query, userID, passwordHash, now, now)
+	return err
+}
+
+func (r *credentialRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	query := `
+		UPDATE credentials 
+		SET email_verified_at = COALESCE(email_verified_at, ?), updated_at = ? 
+		WHERE user_id = ?`
+
+	now := time.Now().Unix()
+	_, err := r.db.ExecContext(ctx, query, now, now, userID)
+	return err
+}
+
+func (r *credentialRepository) RecordFailure(ctx context.Context, userID string, maxAttempts int, lockUntil time.Time) (bool, error) {
+	// Reaching the limit locks the credential and starts the count again for when the lock expires
+	query := `
+		UPDATE credentials 
+		SET failed_attempts = CASE WHEN failed_attempts + 1 >= ? THEN 0 ELSE failed_attempts + 1 END,
+			locked_until = CASE WHEN failed_attempts + 1 >= ? THEN ? ELSE locked_until END,
+			updated_at = ? 
+		WHERE user_id = ? 
+		RETURNING locked_until`
+
+	var lockedUntil sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, maxAttempts, maxAttempts, lockUntil.Unix(), time.Now().Unix(), userID).Scan(&lockedUntil)
+	if err != nil {
+		return false, err
+	}
+
+	return lockedUntil.Valid && lockedUntil.Int64 > time.Now().Unix(), nil
+}
+
+func (r *credentialRepository) ResetFailures(ctx context.Context, userID string) error {
+	query := `
+		UPDATE credentials 
+		SET failed_attempts = 0, locked_until = NULL, updated_at = ? 
+		WHERE user_id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now().Unix(), userID)
+	return err
+}
+
+func (r *credentialRepository) DeleteUnverified(ctx context.Context, userID string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM credentials WHERE user_id = ? AND email_verified_at IS NULL`, userID)
+	return err
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// ErrIdentityTaken is returned when the provider account is already linked to a
+// user, or the user already has an account linked for the provider
+var ErrIdentityTaken = errors.New("identity is already linked")
+
+type IdentityRepository interface {
+	FindByProviderSubject(ctx context.Context, provider domain.AuthProvider, subject string) (*domain.Identity, error)
+	ListByUserID(ctx context.Context, userID string) ([]domain.Identity, error)
+	Create(ctx context.Context, identity *domain.Identity) error
+	// Delete unlinks the user's identity for provider, returning sql.ErrNoRows when there is none
+	Delete(ctx context.Context, userID string, provider domain.AuthProvider) error
+}
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) FindByProviderSubject(ctx context.Context, provider domain.AuthProvider, subject string) (*domain.Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at 
+		FROM identities 
+		WHERE provider = ? AND subject = ?`
+
+	var identity domain.Identity
+	var createdAt int64
+
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &createdAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	identity.CreatedAt = time.Unix(createdAt, 0)
+	return &identity, nil
+}
+
+func (r *identityRepository) ListByUserID(ctx context.Context, userID string) ([]domain.Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at 
+		FROM identities 
+		WHERE user_id = ? 
+		ORDER BY created_at ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []domain.Identity{}
+	for rows.Next() {
+		var identity domain.Identity
+		var createdAt int64
+		if err := rows.Scan(
+			&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &createdAt,
+		); err != nil {
+			return nil, err
+		}
+		identity.CreatedAt = time.Unix(createdAt, 0)
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+func (r *identityRepository) Create(ctx context.Context, identity *domain.Identity) error {
+	query := `
+		INSERT INTO identities (id, user_id, provider, subject, email, created_at) 
+		VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.ExecContext(ctx, query,
+		identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt.Unix(),
+	)
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrIdentityTaken
+	}
+	return err
+}
+
+func (r *identityRepository) Delete(ctx context.Context, userID string, provider domain.AuthProvider) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM identities WHERE user_id = ? AND provider = ?`, userID, provider)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+type OAuthStateRepository interface {
+	Create(ctx context.Context, state *domain.OAuthState) error
+	// Consume deletes the state and returns it, or sql.ErrNoRows when it doesn't exist or has expired
+	Consume(ctx context.Context, state string) (*domain.OAuthState, error)
+}
+
+type oauthStateRepository struct {
+	db *sql.DB
+}
+
+func NewOAuthStateRepository(db *sql.DB) OAuthStateRepository {
+	return &oauthStateRepository{db: db}
+}
+
+func (r *oauthStateRepository) Create(ctx context.Context, state *domain.OAuthState) error {
+	// Drop logins that were abandoned before their callback
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oauth_states WHERE expires_at <= ?`, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oauth_states (state, provider, code_verifier, redirect_to, link_user_id, created_at, expires_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.ExecContext(ctx, query,
+		state.State, state.Provider, state.CodeVerifier, state.RedirectTo, sql.NullString{String: state.LinkUserID, Valid: state.LinkUserID != ""},
+		state.CreatedAt.Unix(), state.ExpiresAt.Unix(),
+	)
+	return err
+}
+
+func (r *oauthStateRepository) Consume(ctx context.Context, state string) (*domain.OAuthState, error) {
+	query := `
+		DELETE FROM oauth_states 
+		WHERE state = ? 
+		RETURNING state, provider, code_verifier, redirect_to, link_user_id, created_at, expires_at`
+
+	var s domain.OAuthState
+	var linkUserID sql.NullString
+	var createdAt, expiresAt int64
+
+	err := r.db.QueryRowContext(ctx, query, state).Scan(
+		&s.State, &s.Provider, &s.CodeVerifier, &s.RedirectTo, &linkUserID, &createdAt, &expiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s.LinkUserID = linkUserID.String
+	s.CreatedAt = time.Unix(createdAt, 0)
+	s.ExpiresAt = time.Unix(expiresAt, 0)
+	if !s.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+
+	return &s, nil
+}
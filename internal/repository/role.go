@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// ErrRoleNotFound is returned when assigning a role that doesn't exist
+var ErrRoleNotFound = errors.New("role not found")
+
+type RoleRepository interface {
+	// PermissionsForUser returns every permission granted by the user's roles
+	PermissionsForUser(ctx context.Context, userID string) ([]domain.Permission, error)
+	RolesForUser(ctx context.Context, userID string) ([]domain.Role, error)
+	// Assign gives the user role, doing nothing if they already have it
+	Assign(ctx context.Context, userID string, role domain.Role) error
+	// Remove takes role away from the user, returning sql.ErrNoRows when they don't have it
+	Remove(ctx context.Context, userID string, role domain.Role) error
+}
+
+type roleRepository struct {
+	db *sql.DB
+}
+
+func NewRoleRepository(db *sql.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
+func (r *roleRepository) PermissionsForUser(ctx context.Context, userID string) ([]domain.Permission, error) {
+	query := `
+		SELECT DISTINCT rp.permission_id
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		WHERE ur.user_id = ?`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []domain.Permission{}
+	for rows.Next() {
+		var permission domain.Permission
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+func (r *roleRepository) RolesForUser(ctx context.Context, userID string) ([]domain.Role, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT role_id FROM user_roles WHERE user_id = ? ORDER BY role_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []domain.Role{}
+	for rows.Next() {
+		var role domain.Role
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *roleRepository) Assign(ctx context.Context, userID string, role domain.Role) error {
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM roles WHERE id = ?)`, role).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrRoleNotFound
+	}
+
+	query := `
+		INSERT INTO user_roles (user_id, role_id, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id, role_id) DO NOTHING`
+
+	_, err := r.db.ExecContext(ctx, query, userID, role, time.Now().Unix())
+	return err
+}
+
+func (r *roleRepository) Remove(ctx context.Context, userID string, role domain.Role) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = ? AND role_id = ?`, userID, role)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
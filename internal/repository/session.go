@@ -10,8 +10,24 @@ import (
 
 type SessionRepository interface {
 	Create(ctx context.Context, session *domain.Session) error
-	FindByTokenWithUser(ctx context.Context, token string) (*domain.ValidateSessionDTO, error)
-	DeleteByToken(ctx context.Context, token string) error
+	// FindByTokenWithUser finds the active session with tokenHash, also accepting
+	// the hash a session was rotated away from if the rotation was after previousValidSince
+	FindByTokenWithUser(ctx context.Context, tokenHash string, previousValidSince time.Time) (*domain.ValidateSessionDTO, error)
+	// ListByUserID returns the user's active sessions, most recently used first
+	ListByUserID(ctx context.Context, userID string) ([]domain.Session, error)
+	// Touch records activity on the session and extends it to expiredAt
+	Touch(ctx context.Context, id string, client domain.ClientInfo, lastSeenAt time.Time, expiredAt time.Time) error
+	// Rotate replaces the session's token hash with tokenHash, keeping the old one as
+	// its previous hash. It only applies while the session's hash is still currentHash,
+	// returning sql.ErrNoRows when the session is gone or was already rotated.
+	Rotate(ctx context.Context, id string, currentHash string, tokenHash string) error
+	// DeleteByToken ends the session signed in with tokenHash, which may also be
+	// its previous token if that was rotated after previousValidSince
+	DeleteByToken(ctx context.Context, tokenHash string, previousValidSince time.Time) error
+	// DeleteByID ends one of the user's sessions, returning sql.ErrNoRows when it has none with id
+	DeleteByID(ctx context.Context, userID string, id string) error
+	// DeleteByUserID ends all of the user's sessions except exceptID
+	DeleteByUserID(ctx context.Context, userID string, exceptID string) error
 }
 
 type sessionRepository struct {
@@ -22,53 +38,76 @@ func NewSessionRepository(db *sql.DB) SessionRepository {
 	return &sessionRepository{db: db}
 }
 
+// sessionColumns are the columns scanSession reads, in order
+const sessionColumns = `s.id, s.user_id, s.token_hash, s.provider, s.user_agent, s.ip_address,
+	s.last_seen_at, s.rotated_at, s.expired_at, s.created_at, s.deleted_at`
+
+// scanSession scans sessionColumns into a session, followed by any extra destinations
+func scanSession(row interface{ Scan(...any) error }, extra ...any) (*domain.Session, error) {
+	var session domain.Session
+	var lastSeenAt, expiredAt, createdAt int64
+	var rotatedAt, deletedAt sql.NullInt64
+
+	dest := []any{
+		&session.ID, &session.UserID, &session.TokenHash, &session.Provider, &session.UserAgent, &session.IPAddress,
+		&lastSeenAt, &rotatedAt, &expiredAt, &createdAt, &deletedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	session.LastSeenAt = time.Unix(lastSeenAt, 0)
+	session.ExpiredAt = time.Unix(expiredAt, 0)
+	session.CreatedAt = time.Unix(createdAt, 0)
+	if rotatedAt.Valid {
+		rotatedTime := time.Unix(rotatedAt.Int64, 0)
+		session.RotatedAt = &rotatedTime
+	}
+	if deletedAt.Valid {
+		deletedTime := time.Unix(deletedAt.Int64, 0)
+		session.DeletedAt = &deletedTime
+	}
+
+	return &session, nil
+}
+
 func (r *sessionRepository) Create(ctx context.Context, session *domain.Session) error {
 	query := `
-		INSERT INTO sessions (id, user_id, token, provider, expired_at, created_at) 
-		VALUES (?, ?, ?, ?, ?, ?)`
+		INSERT INTO sessions (id, user_id, token_hash, provider, user_agent, ip_address, last_seen_at, expired_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	_, err := r.db.ExecContext(ctx, query,
-		session.ID, session.UserID, session.Token, session.Provider,
-		session.ExpiredAt.Unix(), session.CreatedAt.Unix(),
+		session.ID, session.UserID, session.TokenHash, session.Provider, session.UserAgent, session.IPAddress,
+		session.LastSeenAt.Unix(), session.ExpiredAt.Unix(), session.CreatedAt.Unix(),
 	)
 	return err
 }
 
-func (r *sessionRepository) FindByTokenWithUser(ctx context.Context, token string) (*domain.ValidateSessionDTO, error) {
+func (r *sessionRepository) FindByTokenWithUser(ctx context.Context, tokenHash string, previousValidSince time.Time) (*domain.ValidateSessionDTO, error) {
 	query := `
-		SELECT 
-			s.id, s.user_id, s.token, s.provider, s.expired_at, s.created_at, s.deleted_at,
+		SELECT
+			` + sessionColumns + `,
 			u.id, u.name, u.email, u.username, u.profile_pic, u.created_at, u.updated_at, u.deleted_at
 		FROM sessions s
 		JOIN users u ON s.user_id = u.id
-		WHERE s.token = ? AND s.deleted_at IS NULL AND s.expired_at > ?`
+		WHERE (s.token_hash = ? OR (s.previous_token_hash = ? AND s.rotated_at > ?))
+			AND s.deleted_at IS NULL AND s.expired_at > ?`
 
-	row := r.db.QueryRowContext(ctx, query, token, time.Now().Unix())
+	row := r.db.QueryRowContext(ctx, query, tokenHash, tokenHash, previousValidSince.Unix(), time.Now().Unix())
 
 	var dto domain.ValidateSessionDTO
-	var sessionCreatedAt, sessionExpiredAt int64
-	var sessionDeletedAt sql.NullInt64
 	var userCreatedAt, userUpdatedAt int64
 	var userDeletedAt sql.NullInt64
 
-	err := row.Scan(
-		&dto.Session.ID, &dto.Session.UserID, &dto.Session.Token, &dto.Session.Provider,
-		&sessionExpiredAt, &sessionCreatedAt, &sessionDeletedAt,
+	session, err := scanSession(row,
 		&dto.User.ID, &dto.User.Name, &dto.User.Email, &dto.User.Username, &dto.User.ProfilePic,
 		&userCreatedAt, &userUpdatedAt, &userDeletedAt,
 	)
-
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert timestamps
-	dto.Session.ExpiredAt = time.Unix(sessionExpiredAt, 0)
-	dto.Session.CreatedAt = time.Unix(sessionCreatedAt, 0)
-	if sessionDeletedAt.Valid {
-		deletedTime := time.Unix(sessionDeletedAt.Int64, 0)
-		dto.Session.DeletedAt = &deletedTime
-	}
+	dto.Session = *session
 
 	dto.User.CreatedAt = time.Unix(userCreatedAt, 0)
 	dto.User.UpdatedAt = time.Unix(userUpdatedAt, 0)
@@ -80,12 +119,99 @@ func (r *sessionRepository) FindByTokenWithUser(ctx context.Context, token strin
 	return &dto, nil
 }
 
-func (r *sessionRepository) DeleteByToken(ctx context.Context, token string) error {
+func (r *sessionRepository) ListByUserID(ctx context.Context, userID string) ([]domain.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions s
+		WHERE s.user_id = ? AND s.deleted_at IS NULL AND s.expired_at > ?
+		ORDER BY s.last_seen_at DESC, s.created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []domain.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (r *sessionRepository) Touch(ctx context.Context, id string, client domain.ClientInfo, lastSeenAt time.Time, expiredAt time.Time) error {
+	query := `
+		UPDATE sessions
+		SET last_seen_at = ?, expired_at = MAX(expired_at, ?), user_agent = ?, ip_address = ?
+		WHERE id = ? AND deleted_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, lastSeenAt.Unix(), expiredAt.Unix(), client.UserAgent, client.IPAddress, id)
+	return err
+}
+
+func (r *sessionRepository) Rotate(ctx context.Context, id string, currentHash string, tokenHash string) error {
+	query := `
+		UPDATE sessions
+		SET previous_token_hash = token_hash, token_hash = ?, rotated_at = ?
+		WHERE id = ? AND token_hash = ? AND deleted_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, tokenHash, time.Now().Unix(), id, currentHash)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sessionRepository) DeleteByToken(ctx context.Context, tokenHash string, previousValidSince time.Time) error {
+	query := `
+		UPDATE sessions
+		SET deleted_at = ?
+		WHERE (token_hash = ? OR (previous_token_hash = ? AND rotated_at > ?)) AND deleted_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now().Unix(), tokenHash, tokenHash, previousValidSince.Unix())
+	return err
+}
+
+func (r *sessionRepository) DeleteByID(ctx context.Context, userID string, id string) error {
+	query := `
+		UPDATE sessions
+		SET deleted_at = ?
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().Unix(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sessionRepository) DeleteByUserID(ctx context.Context, userID string, exceptID string) error {
 	query := `
-		UPDATE sessions 
-		SET deleted_at = ? 
-		WHERE token = ? AND deleted_at IS NULL`
+		UPDATE sessions
+		SET deleted_at = ?
+		WHERE user_id = ? AND id != ? AND deleted_at IS NULL`
 
-	_, err := r.db.ExecContext(ctx, query, time.Now().Unix(), token)
+	_, err := r.db.ExecContext(ctx, query, time.Now().Unix(), userID, exceptID)
 	return err
 }
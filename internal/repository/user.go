@@ -3,14 +3,29 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 
+	"github.com/mattn/go-sqlite3"
+
 	"github.com/thantko20/tubbym-backend/internal/domain"
 )
 
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 type UserRepository interface {
+	FindByID(ctx context.Context, id string) (*domain.User, error)
 	FindByEmail(ctx context.Context, email string) (*domain.User, error)
 	Create(ctx context.Context, user *domain.User) error
+	// CreateTx creates the user as part of tx
+	CreateTx(ctx context.Context, tx *sql.Tx, user *domain.User) error
+	Update(ctx context.Context, user *domain.User) error
 }
 
 type userRepository struct {
@@ -21,26 +36,39 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
+func (r *userRepository) FindByID(ctx context.Context, id string) (*domain.User, error) {
+	query := `
+		SELECT id, name, email, username, profile_pic, created_at, updated_at, deleted_at 
+		FROM users 
+		WHERE id = ? AND deleted_at IS NULL`
+
+	return scanUser(r.db.QueryRowContext(ctx, query, id))
+}
+
 func (r *userRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
 	query := `
 		SELECT id, name, email, username, profile_pic, created_at, updated_at, deleted_at 
 		FROM users 
 		WHERE email = ? AND deleted_at IS NULL`
 
-	row := r.db.QueryRowContext(ctx, query, email)
+	return scanUser(r.db.QueryRowContext(ctx, query, email))
+}
 
+func scanUser(row *sql.Row) (*domain.User, error) {
 	var user domain.User
+	var profilePic sql.NullString
 	var createdAt, updatedAt int64
 	var deletedAt sql.NullInt64
 
 	err := row.Scan(
-		&user.ID, &user.Name, &user.Email, &user.Username, &user.ProfilePic,
+		&user.ID, &user.Name, &user.Email, &user.Username, &profilePic,
 		&createdAt, &updatedAt, &deletedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	user.ProfilePic = profilePic.String
 	user.CreatedAt = time.Unix(createdAt, 0)
 	user.UpdatedAt = time.Unix(updatedAt, 0)
 	if deletedAt.Valid {
@@ -52,13 +80,45 @@ func (r *userRepository) FindByEmail(ctx context.Context, email string) (*domain
 }
 
 func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
+	return r.create(ctx, r.db, user)
+}
+
+func (r *userRepository) CreateTx(ctx context.Context, tx *sql.Tx, user *domain.User) error {
+	return r.create(ctx, tx, user)
+}
+
+func (r *userRepository) create(ctx context.Context, db execer, user *domain.User) error {
 	query := `
 		INSERT INTO users (id, name, email, username, profile_pic, created_at, updated_at) 
 		VALUES (?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := db.ExecContext(ctx, query,
 		user.ID, user.Name, user.Email, user.Username, user.ProfilePic,
 		user.CreatedAt.Unix(), user.UpdatedAt.Unix(),
 	)
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique && strings.Contains(sqliteErr.Error(), "users.username") {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+// Update saves the user's profile fields, returning ErrUsernameTaken when
+// another user has the username
+func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
+	query := `
+		UPDATE users 
+		SET name = ?, username = ?, profile_pic = ?, updated_at = ? 
+		WHERE id = ? AND deleted_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query,
+		user.Name, user.Username, user.ProfilePic, user.UpdatedAt.Unix(), user.ID,
+	)
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrUsernameTaken
+	}
 	return err
 }
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// HandleObjectCreated confirms and queues processing of a raw video once
+// storage reports it was written. Notifications may be duplicated or arrive
+// after the client confirmed the upload itself, so events for other objects,
+// unknown videos and videos already past upload are ignored.
+func (s *videoService) HandleObjectCreated(ctx context.Context, key string) error {
+	videoID, ok := videoIDFromKey(key)
+	if !ok {
+		return nil
+	}
+
+	video, err := s.GetVideoByID(ctx, videoID)
+	if err != nil {
+		var domainErr *domain.AppError
+		if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeVideoNotFound {
+			slog.Warn("ignoring upload for unknown video", "key", key)
+			return nil
+		}
+		return err
+	}
+
+	if video.Status == domain.VideoStatusPendingUpload {
+		if video, err = s.ConfirmUpload(ctx, videoID); err != nil {
+			var domainErr *domain.AppError
+			if errors.As(err, &domainErr) {
+				// The object itself is unusable, retrying the event won't help
+				slog.Warn("rejected uploaded video", "videoId", videoID, "reason", domainErr.Message)
+				return nil
+			}
+			return err
+		}
+	}
+
+	if video.Status != domain.VideoStatusUploaded {
+		return nil
+	}
+
+	err = s.ProcessVideo(ctx, domain.ProcessVideoReq{VideoID: videoID})
+	var domainErr *domain.AppError
+	if errors.As(err, &domainErr) && domainErr.Code == domain.ErrCodeVideoAlreadyProcessing {
+		return nil
+	}
+	return err
+}
+
+// videoIDFromKey extracts the video ID from a raw video key, raw-videos/<id>.mp4
+func videoIDFromKey(key string) (string, bool) {
+	name, ok := strings.CutPrefix(key, domain.RawVideoPrefix)
+	if !ok {
+		return "", false
+	}
+
+	id, ok := strings.CutSuffix(name, ".mp4")
+	if !ok || uuid.Validate(id) != nil {
+		return "", false
+	}
+
+	return id, true
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/storage"
+)
+
+const (
+	defaultPartSize = 64 << 20
+	// Every part but the last must be at least 5 MiB
+	minPartSize = 5 << 20
+)
+
+// partLayout picks a part size that keeps fileSize within the part limit
+func partLayout(fileSize int64) (int64, int) {
+	partSize := int64(defaultPartSize)
+	if limit := (fileSize + storage.MaxUploadParts - 1) / storage.MaxUploadParts; limit > partSize {
+		// Round up to a whole MiB
+		partSize = (limit + 1<<20 - 1) / (1 << 20) * (1 << 20)
+	}
+	partSize = max(partSize, minPartSize)
+
+	if fileSize == 0 {
+		return partSize, 0
+	}
+	return partSize, int((fileSize + partSize - 1) / partSize)
+}
+
+// StartMultipartUpload begins a new multipart upload of the raw video,
+// abandoning any upload already in progress
+func (s *videoService) StartMultipartUpload(ctx context.Context, videoID string, payload domain.StartMultipartUploadReq) (*domain.VideoUpload, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	video, err := s.GetVideoByID(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if video.Status != domain.VideoStatusPendingUpload {
+		return nil, domain.NewAppError(domain.ErrCodeInvalidUpload, "Video upload has already been confirmed", nil)
+	}
+
+	if video.UploadID != "" {
+		if err := s.storage.AbortMultipartUpload(ctx, video.Key, video.UploadID); err != nil && !errors.Is(err, storage.ErrUploadNotFound) {
+			slog.Warn("failed to abort previous multipart upload", "videoId", video.ID, "uploadId", video.UploadID, "error", err)
+		}
+	}
+
+	return s.startMultipartUpload(ctx, video, payload.FileSize, payload.ContentType)
+}
+
+func (s *videoService) startMultipartUpload(ctx context.Context, video *domain.Video, fileSize int64, contentType string) (*domain.VideoUpload, error) {
+	uploadID, err := s.storage.CreateMultipartUpload(ctx, video.Key, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	if err := s.setUploadID(ctx, video.ID, uploadID); err != nil {
+		if abortErr := s.storage.AbortMultipartUpload(ctx, video.Key, uploadID); abortErr != nil {
+			slog.Warn("failed to abort unrecorded multipart upload", "videoId", video.ID, "uploadId", uploadID, "error", abortErr)
+		}
+		return nil, err
+	}
+	video.UploadID = uploadID
+
+	partSize, partCount := partLayout(fileSize)
+	return &domain.VideoUpload{
+		Mode:      domain.UploadModeMultipart,
+		PartSize:  partSize,
+		PartCount: partCount,
+	}, nil
+}
+
+// PresignUploadParts returns upload URLs for the requested parts of the video's multipart upload
+func (s *videoService) PresignUploadParts(ctx context.Context, videoID string, payload domain.PresignPartsReq) ([]domain.PresignedPart, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	video, err := s.multipartVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]domain.PresignedPart, 0, len(payload.PartNumbers))
+	for _, partNumber := range payload.PartNumbers {
+		url, err := s.storage.GetPresignedPartURL(ctx, video.Key, video.UploadID, partNumber)
+		if err != nil {
+			return nil, s.multipartError(err)
+		}
+		parts = append(parts, domain.PresignedPart{PartNumber: partNumber, URL: url})
+	}
+
+	return parts, nil
+}
+
+// ListUploadParts returns the parts uploaded so far, letting clients resume an interrupted upload
+func (s *videoService) ListUploadParts(ctx context.Context, videoID string) ([]storage.UploadPart, error) {
+	video, err := s.multipartVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := s.storage.ListParts(ctx, video.Key, video.UploadID)
+	if err != nil {
+		return nil, s.multipartError(err)
+	}
+
+	return parts, nil
+}
+
+// CompleteMultipartUpload assembles the uploaded parts and confirms the upload
+func (s *videoService) CompleteMultipartUpload(ctx context.Context, videoID string, payload domain.CompleteMultipartUploadReq) (*domain.Video, error) {
+	video, err := s.multipartVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []storage.UploadPart
+	if len(payload.Parts) == 0 {
+		if parts, err = s.storage.ListParts(ctx, video.Key, video.UploadID); err != nil {
+			return nil, s.multipartError(err)
+		}
+	} else {
+		for _, part := range payload.Parts {
+			parts = append(parts, storage.UploadPart{PartNumber: part.PartNumber, ETag: part.ETag})
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, domain.NewAppError(domain.ErrCodeInvalidUpload, "No parts have been uploaded", nil)
+	}
+
+	if err := s.storage.CompleteMultipartUpload(ctx, video.Key, video.UploadID, parts); err != nil {
+		if errors.Is(err, storage.ErrUploadNotFound) {
+			return nil, s.multipartError(err)
+		}
+		slog.Error("failed to complete multipart upload", "videoId", video.ID, "uploadId", video.UploadID, "error", err)
+		return nil, domain.NewAppError(domain.ErrCodeInvalidUpload, "Multipart upload could not be completed", err)
+	}
+
+	if err := s.setUploadID(ctx, video.ID, ""); err != nil {
+		return nil, err
+	}
+
+	return s.ConfirmUpload(ctx, video.ID)
+}
+
+// AbortMultipartUpload discards the video's multipart upload and any uploaded parts
+func (s *videoService) AbortMultipartUpload(ctx context.Context, videoID string) error {
+	video, err := s.multipartVideo(ctx, videoID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.AbortMultipartUpload(ctx, video.Key, video.UploadID); err != nil && !errors.Is(err, storage.ErrUploadNotFound) {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+
+	return s.setUploadID(ctx, video.ID, "")
+}
+
+// multipartVideo loads a video that has a multipart upload in progress
+func (s *videoService) multipartVideo(ctx context.Context, videoID string) (*domain.Video, error) {
+	video, err := s.GetVideoByID(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if video.UploadID == "" || video.Status != domain.VideoStatusPendingUpload {
+		return nil, domain.NewAppError(domain.ErrCodeNoMultipartUpload, "Video has no multipart upload in progress", nil)
+	}
+
+	return video, nil
+}
+
+func (s *videoService) multipartError(err error) error {
+	if errors.Is(err, storage.ErrUploadNotFound) {
+		return domain.NewAppError(domain.ErrCodeNoMultipartUpload, "Multipart upload no longer exists", err)
+	}
+	return err
+}
+
+func (s *videoService) setUploadID(ctx context.Context, videoID string, uploadID string) error {
+	var value any
+	if uploadID != "" {
+		value = uploadID
+	}
+
+	_, err := s.db.ExecContext(ctx, `UPDATE videos SET upload_id = ?, updated_at = ? WHERE id = ?`, value, time.Now().Unix(), videoID)
+	return err
+}
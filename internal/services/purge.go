@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/storage"
+)
+
+// Most deleted videos purged in one run, so a backlog is worked through gradually
+const purgeBatchSize = 100
+
+// PurgeDeletedVideos permanently removes videos deleted before deletedBefore,
+// along with every storage object belonging to them. A dry run only reports
+// what would be removed.
+func (s *videoService) PurgeDeletedVideos(ctx context.Context, deletedBefore time.Time, dryRun bool) (*domain.VideoPurgeReport, error) {
+	// Videos never attempted come first, then those whose last attempt is
+	// oldest, so videos that keep failing can't hold up the rest
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+videoColumns+` FROM videos WHERE deleted_at IS NOT NULL AND deleted_at < ?
+		ORDER BY purging_at IS NOT NULL, purging_at, deleted_at LIMIT ?`,
+		deletedBefore.Unix(), purgeBatchSize)
+	if err != nil {
+		return nil, domain.NewAppError(domain.ErrCodeVideoDatabaseError, "Failed to query deleted videos", err)
+	}
+
+	var videos []*domain.Video
+	for rows.Next() {
+		video, err := s.scanVideo(rows)
+		if err != nil {
+			rows.Close()
+			return nil, domain.NewAppError(domain.ErrCodeVideoDatabaseError, "Failed to scan video", err)
+		}
+		videos = append(videos, video)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, domain.NewAppError(domain.ErrCodeVideoDatabaseError, "Failed to query deleted videos", err)
+	}
+
+	report := &domain.VideoPurgeReport{
+		DryRun:        dryRun,
+		DeletedBefore: deletedBefore,
+		Videos:        []domain.PurgedVideo{},
+	}
+
+	for _, video := range videos {
+		purged := domain.PurgedVideo{
+			ID:        video.ID,
+			UserID:    video.UserID,
+			Title:     video.Title,
+			DeletedAt: *video.DeletedAt,
+			Objects:   []string{},
+		}
+
+		objects, err := s.videoObjects(ctx, video)
+		if err == nil {
+			for _, object := range objects {
+				purged.Objects = append(purged.Objects, object.Key)
+				purged.Bytes += object.Size
+			}
+			if !dryRun {
+				err = s.purgeVideo(ctx, video, deletedBefore, objects)
+			}
+		}
+		if errors.Is(err, errVideoRestored) {
+			slog.Info("skipped purging restored video", "videoId", video.ID)
+			continue
+		}
+		if err != nil {
+			slog.Error("failed to purge deleted video", "videoId", video.ID, "error", err)
+			purged.Error = err.Error()
+		}
+
+		report.Videos = append(report.Videos, purged)
+		report.ObjectCount += len(purged.Objects)
+		report.Bytes += purged.Bytes
+	}
+
+	return report, nil
+}
+
+// videoObjects lists the raw upload, custom thumbnail uploads and processed
+// renditions stored for the video
+func (s *videoService) videoObjects(ctx context.Context, video *domain.Video) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+
+	if video.Key != "" {
+		info, err := s.storage.Stat(ctx, video.Key)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, fmt.Errorf("failed to stat %s: %w", video.Key, err)
+		}
+		if info != nil {
+			objects = append(objects, *info)
+		}
+	}
+
+	for _, prefix := range []string{thumbnailUploadPrefix(video.ID), domain.ProcessedVideoPrefix + video.ID + "/"} {
+		listed, err := s.storage.List(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+		objects = append(objects, listed...)
+	}
+
+	return objects, nil
+}
+
+// errVideoRestored reports that a video was restored before it could be purged
+var errVideoRestored = errors.New("video was restored")
+
+// purgeVideo claims the video so it can no longer be restored, recording when
+// it was last attempted, then deletes its objects and its row. The row is kept
+// when any object can't be deleted, so a later run tries again.
+func (s *videoService) purgeVideo(ctx context.Context, video *domain.Video, deletedBefore time.Time, objects []storage.ObjectInfo) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE videos SET purging_at = ? WHERE id = ? AND deleted_at IS NOT NULL AND deleted_at < ?`,
+		time.Now().Unix(), video.ID, deletedBefore.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to claim video: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to claim video: %w", err)
+	} else if affected == 0 {
+		return errVideoRestored
+	}
+
+	if video.UploadID != "" {
+		if err := s.storage.AbortMultipartUpload(ctx, video.Key, video.UploadID); err != nil && !errors.Is(err, storage.ErrUploadNotFound) {
+			return fmt.Errorf("failed to abort multipart upload: %w", err)
+		}
+	}
+
+	for _, object := range objects {
+		if err := s.storage.Delete(ctx, object.Key); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", object.Key, err)
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM videos WHERE id = ? AND deleted_at IS NOT NULL`, video.ID); err != nil {
+		return fmt.Errorf("failed to delete video row: %w", err)
+	}
+
+	return nil
+}
+
+// VideoReaper periodically purges videos that have been deleted for longer
+// than the retention period
+type VideoReaper struct {
+	videos    VideoService
+	retention time.Duration
+	interval  time.Duration
+	dryRun    bool
+}
+
+// NewVideoReaper creates a reaper that runs every interval. In dry run mode it
+// only logs what it would purge.
+func NewVideoReaper(videos VideoService, retention time.Duration, interval time.Duration, dryRun bool) *VideoReaper {
+	return &VideoReaper{
+		videos:    videos,
+		retention: retention,
+		interval:  interval,
+		dryRun:    dryRun,
+	}
+}
+
+// Report returns what the next run would purge, without removing anything
+func (r *VideoReaper) Report(ctx context.Context) (*domain.VideoPurgeReport, error) {
+	return r.videos.PurgeDeletedVideos(ctx, time.Now().Add(-r.retention), true)
+}
+
+// Run purges once immediately and then every interval until ctx is cancelled
+func (r *VideoReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *VideoReaper) runOnce(ctx context.Context) {
+	report, err := r.videos.PurgeDeletedVideos(ctx, time.Now().Add(-r.retention), r.dryRun)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("failed to purge deleted videos", "error", err)
+		}
+		return
+	}
+	if len(report.Videos) == 0 {
+		return
+	}
+
+	for _, video := range report.Videos {
+		slog.Info("purge deleted video", "dryRun", r.dryRun, "videoId", video.ID,
+			"deletedAt", video.DeletedAt, "objects", len(video.Objects), "bytes", video.Bytes, "error", video.Error)
+	}
+	slog.Info("purged deleted videos", "dryRun", r.dryRun, "videos", len(report.Videos),
+		"objects", report.ObjectCount, "bytes", report.Bytes)
+}
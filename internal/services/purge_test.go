@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/storage"
+)
+
+// stuckStorage can't delete objects of videos whose ID starts with "stuck"
+type stuckStorage struct {
+	*storage.LocalStorage
+}
+
+func (s stuckStorage) Delete(ctx context.Context, key string) error {
+	if strings.Contains(key, "stuck") {
+		return errors.New("access denied")
+	}
+	return s.LocalStorage.Delete(ctx, key)
+}
+
+func insertDeletedVideo(t *testing.T, s *videoService, id string, deletedAt time.Time) {
+	t.Helper()
+	ctx := context.Background()
+
+	video := domain.Video{ID: id, Key: domain.RawVideoPrefix + id + ".mp4", Visibility: domain.VideoVisibilityPublic,
+		Status: domain.VideoStatusReady, CreatedAt: deletedAt, UpdatedAt: deletedAt}
+	if err := s.insertVideo(ctx, video); err != nil {
+		t.Fatalf("insert video: %v", err)
+	}
+	if _, err := s.db.Exec(`UPDATE videos SET deleted_at = ? WHERE id = ?`, deletedAt.Unix(), id); err != nil {
+		t.Fatalf("delete video: %v", err)
+	}
+	if err := s.storage.(stuckStorage).Put(ctx, video.Key, strings.NewReader(id)); err != nil {
+		t.Fatalf("put raw video: %v", err)
+	}
+}
+
+func TestPurgeDeletedVideosMovesPastFailures(t *testing.T) {
+	local, err := storage.NewLocalStorage(t.TempDir(), "http://api.test", "secret")
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	s := &videoService{db: newTestDB(t), storage: stuckStorage{local}}
+	ctx := context.Background()
+
+	// A full batch of videos that can't be purged, all deleted before the one that can
+	deletedAt := time.Now().Add(-48 * time.Hour)
+	for i := range purgeBatchSize {
+		insertDeletedVideo(t, s, fmt.Sprintf("stuck-%03d", i), deletedAt)
+	}
+	insertDeletedVideo(t, s, "healthy", deletedAt.Add(time.Hour))
+
+	report, err := s.PurgeDeletedVideos(ctx, time.Now(), false)
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if len(report.Videos) != purgeBatchSize || report.Videos[0].Error == "" {
+		t.Fatalf("first run reported %d videos, want %d failures", len(report.Videos), purgeBatchSize)
+	}
+
+	report, err = s.PurgeDeletedVideos(ctx, time.Now(), false)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if len(report.Videos) == 0 || report.Videos[0].ID != "healthy" || report.Videos[0].Error != "" {
+		t.Fatalf("second run didn't start with the video behind the failures: %+v", report.Videos[0])
+	}
+
+	var remaining int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM videos WHERE id = 'healthy'`).Scan(&remaining); err != nil {
+		t.Fatalf("count videos: %v", err)
+	}
+	if remaining != 0 {
+		t.Error("healthy video was not purged")
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/repository"
+)
+
+type RoleService interface {
+	// Can reports whether the user's roles grant permission
+	Can(ctx context.Context, userID string, permission domain.Permission) (bool, error)
+	UserRoles(ctx context.Context, userID string) ([]domain.Role, error)
+	AssignRole(ctx context.Context, userID string, role domain.Role) error
+	RemoveRole(ctx context.Context, userID string, role domain.Role) error
+	// AssignRoleByEmail gives role to the user with email, for bootstrapping admins
+	AssignRoleByEmail(ctx context.Context, email string, role domain.Role) (*domain.User, error)
+	RemoveRoleByEmail(ctx context.Context, email string, role domain.Role) (*domain.User, error)
+}
+
+type roleService struct {
+	roleRepo repository.RoleRepository
+	userRepo repository.UserRepository
+}
+
+func NewRoleService(db *sql.DB) RoleService {
+	return &roleService{
+		roleRepo: repository.NewRoleRepository(db),
+		userRepo: repository.NewUserRepository(db),
+	}
+}
+
+func (s *roleService) Can(ctx context.Context, userID string, permission domain.Permission) (bool, error) {
+	if userID == "" {
+		return false, nil
+	}
+
+	permissions, err := s.roleRepo.PermissionsForUser(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load permissions: %w", err)
+	}
+
+	return slices.Contains(permissions, permission), nil
+}
+
+func (s *roleService) UserRoles(ctx context.Context, userID string) ([]domain.Role, error) {
+	roles, err := s.roleRepo.RolesForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+	return roles, nil
+}
+
+func (s *roleService) AssignRole(ctx context.Context, userID string, role domain.Role) error {
+	if _, err := s.findUser(ctx, s.userRepo.FindByID, userID); err != nil {
+		return err
+	}
+
+	err := s.roleRepo.Assign(ctx, userID, role)
+	if errors.Is(err, repository.ErrRoleNotFound) {
+		return domain.NewAppError(domain.ErrCodeRoleNotFound, fmt.Sprintf("Unknown role: %s", role), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	return nil
+}
+
+func (s *roleService) RemoveRole(ctx context.Context, userID string, role domain.Role) error {
+	err := s.roleRepo.Remove(ctx, userID, role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.NewAppError(domain.ErrCodeRoleNotFound, fmt.Sprintf("User doesn't have the %s role", role), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove role: %w", err)
+	}
+	return nil
+}
+
+func (s *roleService) AssignRoleByEmail(ctx context.Context, email string, role domain.Role) (*domain.User, error) {
+	user, err := s.findUser(ctx, s.userRepo.FindByEmail, email)
+	if err != nil {
+		return nil, err
+	}
+	return user, s.AssignRole(ctx, user.ID, role)
+}
+
+func (s *roleService) RemoveRoleByEmail(ctx context.Context, email string, role domain.Role) (*domain.User, error) {
+	user, err := s.findUser(ctx, s.userRepo.FindByEmail, email)
+	if err != nil {
+		return nil, err
+	}
+	return user, s.RemoveRole(ctx, user.ID, role)
+}
+
+func (s *roleService) findUser(ctx context.Context, find func(context.Context, string) (*domain.User, error), key string) (*domain.User, error) {
+	user, err := find(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.NewAppError(domain.ErrCodeAuthUserNotFound, "User not found", nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	return user, nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// Markers snippet() wraps matches in, swapped for <mark> tags once the text is escaped
+const (
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+)
+
+// SearchVideos finds public videos that are ready to watch and whose title or
+// description match the query, best matches first. Every query term also matches as a prefix.
+func (s *videoService) SearchVideos(ctx context.Context, payload domain.VideoSearchReq) ([]domain.VideoSearchResult, int, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	match := ftsQuery(payload.Query)
+	if match == "" {
+		return []domain.VideoSearchResult{}, 0, nil
+	}
+
+	const conditions = `visibility = ? AND status = ? AND deleted_at IS NULL AND hidden_at IS NULL`
+
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM videos
+		JOIN (SELECT rowid AS match_rowid FROM videos_fts WHERE videos_fts MATCH ?) m ON videos.rowid = m.match_rowid
+		WHERE `+conditions, match, domain.VideoVisibilityPublic, domain.VideoStatusReady).Scan(&count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+videoColumns+`, title_snippet, description_snippet FROM videos
+		JOIN (
+			SELECT rowid AS match_rowid,
+				highlight(videos_fts, 0, ?, ?) AS title_snippet,
+				snippet(videos_fts, 1, ?, ?, '…', 24) AS description_snippet,
+				-- Title matches count for more than description matches
+				bm25(videos_fts, 10.0, 1.0) AS rank
+			FROM videos_fts WHERE videos_fts MATCH ?
+		) m ON videos.rowid = m.match_rowid
+		WHERE `+conditions+`
+		ORDER BY m.rank, videos.created_at DESC
+		LIMIT ? OFFSET ?`,
+		highlightStart, highlightEnd, highlightStart, highlightEnd, match,
+		domain.VideoVisibilityPublic, domain.VideoStatusReady, payload.Limit, payload.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := []domain.VideoSearchResult{}
+	for rows.Next() {
+		var titleSnippet, descriptionSnippet string
+		video, err := s.scanVideo(rows, &titleSnippet, &descriptionSnippet)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		results = append(results, domain.VideoSearchResult{
+			Video:                *video,
+			TitleHighlight:       highlightHTML(titleSnippet),
+			DescriptionHighlight: highlightHTML(descriptionSnippet),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return results, count, nil
+}
+
+// ftsQuery turns free text into an FTS5 query matching every term as a
+// prefix. Terms are quoted so operators and punctuation are taken literally.
+func ftsQuery(q string) string {
+	var terms []string
+	for _, term := range strings.Fields(q) {
+		term = strings.ReplaceAll(term, `"`, "")
+		if term == "" {
+			continue
+		}
+		terms = append(terms, `"`+term+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func highlightHTML(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightEnd, "</mark>")
+}
+
+// CheckFTS5 reports an error when SQLite was built without FTS5, which search
+// depends on. go-sqlite3 only includes it when built with the sqlite_fts5 tag.
+func CheckFTS5(ctx context.Context, db *sql.DB) error {
+	// The fts5() function is registered along with the extension
+	if _, err := db.ExecContext(ctx, `SELECT fts5(NULL)`); err != nil {
+		return fmt.Errorf("SQLite was built without FTS5, build with -tags sqlite_fts5: %w", err)
+	}
+	return nil
+}
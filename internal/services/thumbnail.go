@@ -0,0 +1,230 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/storage"
+	"github.com/thantko20/tubbym-backend/internal/transcoder"
+)
+
+const (
+	maxThumbnailBytes  = 5 << 20
+	minThumbnailWidth  = 640
+	minThumbnailHeight = 360
+	maxThumbnailSide   = 8192
+)
+
+type thumbnailSize struct {
+	Width  int
+	Height int
+}
+
+// thumbnailSizes are the renditions custom thumbnails are re-encoded to; the first becomes the video's thumbnail
+var thumbnailSizes = []thumbnailSize{
+	{Width: 1280, Height: 720},
+	{Width: 640, Height: 360},
+	{Width: 320, Height: 180},
+}
+
+var imageContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+func thumbnailUploadPrefix(videoID string) string {
+	return "thumbnail-uploads/" + videoID + "/"
+}
+
+// customThumbnailPrefix is where the renditions of a video's custom thumbnails are stored
+func customThumbnailPrefix(videoID string) string {
+	return domain.ProcessedVideoPrefix + videoID + "/thumbnails/custom_"
+}
+
+// CreateThumbnailUpload returns a storage key and presigned URL the creator uploads a custom thumbnail to
+func (s *videoService) CreateThumbnailUpload(ctx context.Context, videoID string) (string, string, error) {
+	video, err := s.GetVideoByID(ctx, videoID)
+	if err != nil {
+		return "", "", err
+	}
+
+	key := thumbnailUploadPrefix(video.ID) + uuid.New().String()
+	presignedURL, err := s.storage.GetPresignedURL(ctx, key, "")
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, presignedURL, nil
+}
+
+// ConfirmThumbnailUpload validates an uploaded custom thumbnail, re-encodes it
+// to the standard sizes and makes it the video's thumbnail
+func (s *videoService) ConfirmThumbnailUpload(ctx context.Context, videoID string, payload domain.ConfirmThumbnailReq) (*domain.Video, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	video, err := s.GetVideoByID(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(payload.Key, thumbnailUploadPrefix(video.ID)) || strings.Contains(payload.Key, "..") {
+		return nil, domain.NewAppError(domain.ErrCodeInvalidThumbnail, "Thumbnail key does not belong to this video", nil)
+	}
+
+	// Upload URLs don't limit the size, so check it before reading the object into memory
+	info, err := s.storage.Stat(ctx, payload.Key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, domain.NewAppError(domain.ErrCodeInvalidThumbnail, "Thumbnail has not been uploaded", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat thumbnail: %w", err)
+	}
+	if info.Size > maxThumbnailBytes {
+		s.deleteThumbnailUpload(ctx, payload.Key)
+		return nil, domain.NewAppError(domain.ErrCodeInvalidThumbnail, fmt.Sprintf("Thumbnail must be at most %d MB", maxThumbnailBytes>>20), nil)
+	}
+
+	data, err := s.storage.GetObject(ctx, payload.Key)
+	if err != nil {
+		return nil, domain.NewAppError(domain.ErrCodeInvalidThumbnail, "Thumbnail has not been uploaded", err)
+	}
+
+	ext, err := validateThumbnail(data)
+	if err != nil {
+		return nil, err
+	}
+
+	workDir, err := os.MkdirTemp("", "tubbym-thumbnail-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	src := filepath.Join(workDir, "source"+ext)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		return nil, err
+	}
+
+	t := transcoder.New("ffmpeg", "ffprobe", workDir)
+	// A new name per upload so CDN caches never serve the previous image
+	name := "custom_" + uuid.New().String()[:8]
+	var thumbnailKey string
+	for i, size := range thumbnailSizes {
+		file := fmt.Sprintf("%s_%dx%d.jpg", name, size.Width, size.Height)
+		path := filepath.Join(workDir, file)
+		if err := t.ResizeImage(ctx, src, path, size.Width, size.Height); err != nil {
+			return nil, fmt.Errorf("failed to re-encode thumbnail: %w", err)
+		}
+
+		key := domain.ProcessedVideoPrefix + video.ID + "/thumbnails/" + file
+		if err := s.storage.Upload(ctx, key, path); err != nil {
+			return nil, fmt.Errorf("failed to upload thumbnail: %w", err)
+		}
+
+		if i == 0 {
+			thumbnailKey = key
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE videos SET thumbnail_key = ?, updated_at = ? WHERE id = ?`, thumbnailKey, time.Now().Unix(), video.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the re-encoded renditions are served, so the original upload is no longer needed
+	s.deleteThumbnailUpload(ctx, payload.Key)
+
+	updated, err := s.GetVideoByID(ctx, video.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Also keep the set a concurrent confirm may have made current since our update
+	s.deleteCustomThumbnails(ctx, video.ID, customThumbnailSet(thumbnailKey), customThumbnailSet(updated.ThumbnailKey))
+
+	return updated, nil
+}
+
+// customThumbnailSet returns the key prefix shared by the renditions of the
+// custom thumbnail key belongs to, or "" when it isn't a custom thumbnail
+func customThumbnailSet(key string) string {
+	i := strings.LastIndex(key, "_")
+	if i < 0 || !strings.Contains(key, "/thumbnails/custom_") {
+		return ""
+	}
+	return key[:i+1]
+}
+
+// deleteCustomThumbnails removes the renditions of a video's earlier custom
+// thumbnails, except the sets with the given prefixes. Failures are only logged,
+// since the new thumbnail is already in place.
+func (s *videoService) deleteCustomThumbnails(ctx context.Context, videoID string, keep ...string) {
+	objects, err := s.storage.List(ctx, customThumbnailPrefix(videoID))
+	if err != nil {
+		slog.Warn("failed to list previous custom thumbnails", "videoId", videoID, "error", err)
+		return
+	}
+
+	for _, object := range objects {
+		if slices.ContainsFunc(keep, func(prefix string) bool { return prefix != "" && strings.HasPrefix(object.Key, prefix) }) {
+			continue
+		}
+		if err := s.storage.Delete(ctx, object.Key); err != nil {
+			slog.Warn("failed to delete previous custom thumbnail", "key", object.Key, "error", err)
+		}
+	}
+}
+
+// deleteThumbnailUpload removes an uploaded thumbnail, logging rather than failing when it can't
+func (s *videoService) deleteThumbnailUpload(ctx context.Context, key string) {
+	if err := s.storage.Delete(ctx, key); err != nil {
+		slog.Warn("failed to delete thumbnail upload", "key", key, "error", err)
+	}
+}
+
+// validateThumbnail checks the size, type and dimensions of an uploaded image, returning its file extension
+func validateThumbnail(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", domain.NewAppError(domain.ErrCodeInvalidThumbnail, "Thumbnail is empty", nil)
+	}
+	if len(data) > maxThumbnailBytes {
+		return "", domain.NewAppError(domain.ErrCodeInvalidThumbnail, fmt.Sprintf("Thumbnail must be at most %d MB", maxThumbnailBytes>>20), nil)
+	}
+
+	ext, ok := imageContentTypes[http.DetectContentType(data)]
+	if !ok {
+		return "", domain.NewAppError(domain.ErrCodeInvalidThumbnail, "Thumbnail must be a JPEG or PNG image", nil)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", domain.NewAppError(domain.ErrCodeInvalidThumbnail, "Thumbnail image could not be decoded", err)
+	}
+
+	if cfg.Width < minThumbnailWidth || cfg.Height < minThumbnailHeight {
+		return "", domain.NewAppError(domain.ErrCodeInvalidThumbnail,
+			fmt.Sprintf("Thumbnail must be at least %dx%d", minThumbnailWidth, minThumbnailHeight), nil)
+	}
+	if cfg.Width > maxThumbnailSide || cfg.Height > maxThumbnailSide {
+		return "", domain.NewAppError(domain.ErrCodeInvalidThumbnail,
+			fmt.Sprintf("Thumbnail must be at most %dx%d", maxThumbnailSide, maxThumbnailSide), nil)
+	}
+
+	return ext, nil
+}
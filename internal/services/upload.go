@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/storage"
+)
+
+const maxVideoUploadBytes = 20 << 30
+
+// ConfirmUpload checks that the raw video object exists with a plausible size
+// and content type, then marks the video as uploaded so it can be processed
+func (s *videoService) ConfirmUpload(ctx context.Context, videoID string) (*domain.Video, error) {
+	video, err := s.GetVideoByID(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Confirming twice is harmless, whether it came from the client or a storage event
+	if video.Status != domain.VideoStatusPendingUpload {
+		return video, nil
+	}
+
+	info, err := s.storage.Stat(ctx, video.Key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, domain.NewAppError(domain.ErrCodeVideoNotUploaded, "Video file has not been uploaded", nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat uploaded video: %w", err)
+	}
+
+	if info.Size == 0 {
+		return nil, domain.NewAppError(domain.ErrCodeInvalidUpload, "Uploaded video file is empty", nil)
+	}
+	if info.Size > maxVideoUploadBytes {
+		return nil, domain.NewAppError(domain.ErrCodeInvalidUpload, fmt.Sprintf("Video file must be at most %d GB", maxVideoUploadBytes>>30), nil)
+	}
+	if !strings.HasPrefix(info.ContentType, "video/") {
+		return nil, domain.NewAppError(domain.ErrCodeInvalidUpload, fmt.Sprintf("Uploaded file has content type %q, expected a video", info.ContentType), nil)
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE videos SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		domain.VideoStatusUploaded, time.Now().Unix(), video.ID, domain.VideoStatusPendingUpload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update video status: %w", err)
+	}
+
+	slog.Info("video upload confirmed", "videoId", video.ID, "size", info.Size, "contentType", info.ContentType)
+	s.publishProcessingEvent(video.ID, domain.EventTypeVideoStatusUpdate, domain.VideoStatusUploaded, "Video upload confirmed", nil, "")
+
+	video.Status = domain.VideoStatusUploaded
+	return video, nil
+}
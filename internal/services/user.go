@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/repository"
+	"github.com/thantko20/tubbym-backend/internal/storage"
+)
+
+const (
+	maxProfilePicBytes = 2 << 20
+	minProfilePicSide  = 64
+	maxProfilePicSide  = 4096
+)
+
+var avatarFilePattern = regexp.MustCompile(`^[0-9a-f-]{36}\.(jpg|png)$`)
+
+type UserService interface {
+	GetUser(ctx context.Context, id string) (*domain.User, error)
+	UpdateProfile(ctx context.Context, userID string, payload domain.UpdateProfileReq) (*domain.User, error)
+	GetProfilePic(ctx context.Context, userID string, file string) ([]byte, error)
+}
+
+type userService struct {
+	userRepo      repository.UserRepository
+	storage       storage.Storage
+	publicBaseURL string
+}
+
+func NewUserService(db *sql.DB, storage storage.Storage, publicBaseURL string) UserService {
+	return &userService{
+		userRepo:      repository.NewUserRepository(db),
+		storage:       storage,
+		publicBaseURL: publicBaseURL,
+	}
+}
+
+func (s *userService) GetUser(ctx context.Context, id string) (*domain.User, error) {
+	user, err := s.userRepo.FindByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.NewAppError(domain.ErrCodeAuthUserNotFound, "User not found", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UpdateProfile changes the user's name, username and profile picture. A
+// replaced profile picture is deleted once the new one is saved.
+func (s *userService) UpdateProfile(ctx context.Context, userID string, payload domain.UpdateProfileReq) (*domain.User, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	previousPic := user.ProfilePic
+	var newPicFile string
+	if payload.Name != nil {
+		user.Name = *payload.Name
+	}
+	if payload.Username != nil {
+		user.Username = *payload.Username
+	}
+	if payload.ProfilePic != nil {
+		if newPicFile, err = s.storeProfilePic(ctx, user.ID, payload.ProfilePic); err != nil {
+			return nil, err
+		}
+		user.ProfilePic = s.profilePicURL(user.ID, newPicFile)
+	}
+	user.UpdatedAt = time.Now()
+
+	err = s.userRepo.Update(ctx, user)
+	if err != nil {
+		if newPicFile != "" {
+			s.deleteProfilePic(ctx, user.ID, newPicFile)
+		}
+		if errors.Is(err, repository.ErrUsernameTaken) {
+			return nil, domain.NewAppError(domain.ErrCodeUsernameTaken, "Username is already taken", err)
+		}
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if newPicFile != "" {
+		// Pictures from a login provider live elsewhere and are left alone
+		if file, ok := strings.CutPrefix(previousPic, s.profilePicURL(user.ID, "")); ok && avatarFilePattern.MatchString(file) {
+			s.deleteProfilePic(ctx, user.ID, file)
+		}
+	}
+
+	return user, nil
+}
+
+// storeProfilePic validates the image and stores it, returning its file name
+func (s *userService) storeProfilePic(ctx context.Context, userID string, r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxProfilePicBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read profile picture: %w", err)
+	}
+	if len(data) > maxProfilePicBytes {
+		return "", domain.NewAppError(domain.ErrCodeInvalidProfile, fmt.Sprintf("Profile picture must be at most %d MB", maxProfilePicBytes>>20), nil)
+	}
+
+	ext, ok := imageContentTypes[http.DetectContentType(data)]
+	if !ok {
+		return "", domain.NewAppError(domain.ErrCodeInvalidProfile, "Profile picture must be a JPEG or PNG image", nil)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", domain.NewAppError(domain.ErrCodeInvalidProfile, "Profile picture could not be decoded", err)
+	}
+	if config.Width < minProfilePicSide || config.Height < minProfilePicSide {
+		return "", domain.NewAppError(domain.ErrCodeInvalidProfile, fmt.Sprintf("Profile picture must be at least %dx%d", minProfilePicSide, minProfilePicSide), nil)
+	}
+	if config.Width > maxProfilePicSide || config.Height > maxProfilePicSide {
+		return "", domain.NewAppError(domain.ErrCodeInvalidProfile, fmt.Sprintf("Profile picture sides must be at most %d pixels", maxProfilePicSide), nil)
+	}
+
+	tmp, err := os.CreateTemp("", "profile-pic-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	file := uuid.New().String() + ext
+	if err := s.storage.Upload(ctx, profilePicKey(userID, file), tmp.Name()); err != nil {
+		return "", fmt.Errorf("failed to upload profile picture: %w", err)
+	}
+
+	return file, nil
+}
+
+// deleteProfilePic removes a stored profile picture. Failures only leave an
+// unused object behind, so they are logged rather than returned.
+func (s *userService) deleteProfilePic(ctx context.Context, userID string, file string) {
+	if err := s.storage.Delete(ctx, profilePicKey(userID, file)); err != nil {
+		slog.Warn("failed to delete profile picture", "userId", userID, "file", file, "error", err)
+	}
+}
+
+func (s *userService) profilePicURL(userID string, file string) string {
+	return s.publicBaseURL + "/users/" + userID + "/avatar/" + file
+}
+
+// GetProfilePic returns an uploaded profile picture
+func (s *userService) GetProfilePic(ctx context.Context, userID string, file string) ([]byte, error) {
+	if userID == "" || !avatarFilePattern.MatchString(file) {
+		return nil, domain.NewAppError(domain.ErrCodeProfilePicNotFound, "Profile picture not found", nil)
+	}
+
+	key := profilePicKey(userID, file)
+	if _, err := s.storage.Stat(ctx, key); err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, domain.NewAppError(domain.ErrCodeProfilePicNotFound, "Profile picture not found", nil)
+		}
+		return nil, err
+	}
+
+	data, err := s.storage.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func profilePicKey(userID string, file string) string {
+	return "avatars/" + userID + "/" + file
+}
@@ -3,15 +3,21 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/thantko20/tubbym-backend/internal/domain"
+	"github.com/thantko20/tubbym-backend/internal/jobs"
 	"github.com/thantko20/tubbym-backend/internal/pubsub"
 	"github.com/thantko20/tubbym-backend/internal/storage"
 	"github.com/thantko20/tubbym-backend/internal/transcoder"
@@ -20,28 +26,64 @@ import (
 type VideoService interface {
 	GetVideoByID(ctx context.Context, id string) (*domain.Video, error)
 	GetVideos(ctx context.Context, filters *domain.VideoFilters) ([]domain.Video, int, error)
-	CreateVideo(ctx context.Context, payload domain.CreateVideoReq) (*domain.Video, string, error)
-	ProcessVideo(ctx context.Context, videoId string) error
+	AuthorizeOwner(ctx context.Context, videoID string, userID string) (*domain.Video, error)
+	SearchVideos(ctx context.Context, payload domain.VideoSearchReq) ([]domain.VideoSearchResult, int, error)
+	CreateVideo(ctx context.Context, payload domain.CreateVideoReq) (*domain.Video, *domain.VideoUpload, error)
+	ProcessVideo(ctx context.Context, payload domain.ProcessVideoReq) error
+	HandleProcessVideoJob(ctx context.Context, job *jobs.Job) error
+	HandleProcessVideoJobFailed(ctx context.Context, job *jobs.Job)
+	CreateThumbnailUpload(ctx context.Context, videoID string) (string, string, error)
+	ConfirmThumbnailUpload(ctx context.Context, videoID string, payload domain.ConfirmThumbnailReq) (*domain.Video, error)
+	ConfirmUpload(ctx context.Context, videoID string) (*domain.Video, error)
+	StartMultipartUpload(ctx context.Context, videoID string, payload domain.StartMultipartUploadReq) (*domain.VideoUpload, error)
+	PresignUploadParts(ctx context.Context, videoID string, payload domain.PresignPartsReq) ([]domain.PresignedPart, error)
+	ListUploadParts(ctx context.Context, videoID string) ([]storage.UploadPart, error)
+	CompleteMultipartUpload(ctx context.Context, videoID string, payload domain.CompleteMultipartUploadReq) (*domain.Video, error)
+	AbortMultipartUpload(ctx context.Context, videoID string) error
+	HandleObjectCreated(ctx context.Context, key string) error
+	// SetHidden hides the video from everyone but its owner and moderators, or shows it again
+	SetHidden(ctx context.Context, videoID string, hidden bool) (*domain.Video, error)
+	UpdateVideo(ctx context.Context, videoID string, payload domain.UpdateVideoReq) (*domain.Video, error)
+	// DeleteVideo soft deletes the video, leaving it out of every read until it is restored
+	DeleteVideo(ctx context.Context, videoID string) error
+	// AuthorizeDeletedOwner returns the deleted video if userID owns it
+	AuthorizeDeletedOwner(ctx context.Context, videoID string, userID string) (*domain.Video, error)
+	RestoreVideo(ctx context.Context, videoID string) (*domain.Video, error)
+	PurgeDeletedVideos(ctx context.Context, deletedBefore time.Time, dryRun bool) (*domain.VideoPurgeReport, error)
+}
+
+// JobTypeProcessVideo is the queue job type that transcodes an uploaded video
+const JobTypeProcessVideo = "video:process"
+
+type processVideoPayload struct {
+	VideoID    string   `json:"videoId"`
+	Renditions []string `json:"renditions,omitempty"`
 }
 
 type videoService struct {
-	db      *sql.DB
-	storage storage.Storage
-	pubsub  pubsub.Pubsub
+	db               *sql.DB
+	storage          storage.Storage
+	pubsub           pubsub.Pubsub
+	queue            jobs.Queue
+	streamingBaseURL string
+	ladder           []transcoder.Variant
 }
 
-func NewVideoService(db *sql.DB, storage storage.Storage, ps pubsub.Pubsub) VideoService {
+func NewVideoService(db *sql.DB, storage storage.Storage, ps pubsub.Pubsub, queue jobs.Queue, streamingBaseURL string, ladder []transcoder.Variant) VideoService {
 	return &videoService{
-		db:      db,
-		storage: storage,
-		pubsub:  ps,
+		db:               db,
+		storage:          storage,
+		pubsub:           ps,
+		queue:            queue,
+		streamingBaseURL: streamingBaseURL,
+		ladder:           ladder,
 	}
 }
 
 func (s *videoService) GetVideoByID(ctx context.Context, id string) (*domain.Video, error) {
 	// Implementation to fetch video by ID
 
-	videos, _, err := s.findVideos(ctx, &domain.VideoFilters{ID: id})
+	videos, err := s.findVideos(ctx, &domain.VideoFilters{ID: id})
 
 	if err != nil {
 		return nil, err
@@ -54,106 +96,391 @@ func (s *videoService) GetVideoByID(ctx context.Context, id string) (*domain.Vid
 	return &videos[0], nil
 }
 
+// AuthorizeOwner returns the video if userID owns it
+func (s *videoService) AuthorizeOwner(ctx context.Context, videoID string, userID string) (*domain.Video, error) {
+	video, err := s.GetVideoByID(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	return authorizeOwner(video, userID)
+}
+
+func (s *videoService) AuthorizeDeletedOwner(ctx context.Context, videoID string, userID string) (*domain.Video, error) {
+	video, err := s.getDeletedVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	return authorizeOwner(video, userID)
+}
+
+func authorizeOwner(video *domain.Video, userID string) (*domain.Video, error) {
+	if userID == "" || video.UserID != userID {
+		return nil, domain.NewAppError(domain.ErrCodeVideoForbidden, "Only the owner can change this video", nil)
+	}
+
+	return video, nil
+}
+
+// getDeletedVideo finds a video that has been soft deleted
+func (s *videoService) getDeletedVideo(ctx context.Context, videoID string) (*domain.Video, error) {
+	videos, err := s.findVideos(ctx, &domain.VideoFilters{ID: videoID, IncludeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(videos) == 0 || videos[0].DeletedAt == nil {
+		return nil, domain.NewAppError(domain.ErrCodeVideoNotFound, "Video not found", nil)
+	}
+
+	return &videos[0], nil
+}
+
+func (s *videoService) UpdateVideo(ctx context.Context, videoID string, payload domain.UpdateVideoReq) (*domain.Video, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	video, err := s.GetVideoByID(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.Title != nil {
+		video.Title = *payload.Title
+	}
+	if payload.Description != nil {
+		video.Description = *payload.Description
+	}
+	if payload.Visibility != nil {
+		video.Visibility = *payload.Visibility
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE videos SET title = ?, description = ?, visibility = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		video.Title, video.Description, video.Visibility, time.Now().Unix(), videoID)
+	if err != nil {
+		return nil, domain.NewAppError(domain.ErrCodeVideoDatabaseError, "Failed to update video", err)
+	}
+
+	return s.GetVideoByID(ctx, videoID)
+}
+
+func (s *videoService) DeleteVideo(ctx context.Context, videoID string) error {
+	now := time.Now().Unix()
+	result, err := s.db.ExecContext(ctx, `UPDATE videos SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`, now, now, videoID)
+	if err != nil {
+		return domain.NewAppError(domain.ErrCodeVideoDatabaseError, "Failed to delete video", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return domain.NewAppError(domain.ErrCodeVideoDatabaseError, "Failed to delete video", err)
+	}
+	if affected == 0 {
+		return domain.NewAppError(domain.ErrCodeVideoNotFound, "Video not found", nil)
+	}
+
+	return nil
+}
+
+func (s *videoService) RestoreVideo(ctx context.Context, videoID string) (*domain.Video, error) {
+	if _, err := s.getDeletedVideo(ctx, videoID); err != nil {
+		return nil, err
+	}
+
+	// Once the reaper has claimed the video its objects may already be gone
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE videos SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL AND purging_at IS NULL`,
+		time.Now().Unix(), videoID)
+	if err != nil {
+		return nil, domain.NewAppError(domain.ErrCodeVideoDatabaseError, "Failed to restore video", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, domain.NewAppError(domain.ErrCodeVideoDatabaseError, "Failed to restore video", err)
+	} else if affected == 0 {
+		return nil, domain.NewAppError(domain.ErrCodeVideoPurging, "Video is being permanently deleted and can no longer be restored", nil)
+	}
+
+	return s.GetVideoByID(ctx, videoID)
+}
+
+func (s *videoService) SetHidden(ctx context.Context, videoID string, hidden bool) (*domain.Video, error) {
+	if _, err := s.GetVideoByID(ctx, videoID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	var hiddenAt any
+	if hidden {
+		hiddenAt = now
+	}
+
+	// Hiding an already hidden video keeps when it was first hidden
+	query := `UPDATE videos SET hidden_at = CASE WHEN ? IS NULL THEN NULL ELSE COALESCE(hidden_at, ?) END, updated_at = ? WHERE id = ?`
+	if _, err := s.db.ExecContext(ctx, query, hiddenAt, hiddenAt, now, videoID); err != nil {
+		return nil, domain.NewAppError(domain.ErrCodeVideoDatabaseError, "Failed to update video", err)
+	}
+
+	return s.GetVideoByID(ctx, videoID)
+}
+
 func (s *videoService) GetVideos(ctx context.Context, filters *domain.VideoFilters) ([]domain.Video, int, error) {
-	videos, n, err := s.findVideos(ctx, filters)
+	if filters == nil {
+		filters = &domain.VideoFilters{}
+	}
+	if err := filters.Validate(); err != nil {
+		return nil, 0, err
+	}
+	filters.VisibleOnly = true
+
+	videos, err := s.findVideos(ctx, filters)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	return videos, n, nil
+	count, err := s.countVideos(ctx, filters)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return videos, count, nil
 }
 
-func (s *videoService) findVideos(ctx context.Context, filters *domain.VideoFilters) ([]domain.Video, int, error) {
-	var videos []domain.Video
-	var count int
+var videoSortColumns = map[domain.VideoSort]string{
+	domain.VideoSortCreatedAt: "created_at",
+	domain.VideoSortViews:     "views",
+	domain.VideoSortTitle:     "title",
+}
 
+// videoConditions builds the WHERE conditions for filters, ignoring paging
+func videoConditions(filters *domain.VideoFilters) ([]string, []any) {
 	where := []string{"1 = 1"}
 	var params []any
 
-	if filters != nil {
-		if filters.ID != "" {
-			where = append(where, "id = ?")
-			params = append(params, filters.ID)
+	if filters == nil || !filters.IncludeDeleted {
+		where = append(where, "deleted_at IS NULL")
+	}
+	if filters == nil {
+		return where, params
+	}
+
+	if filters.ID != "" {
+		where = append(where, "id = ?")
+		params = append(params, filters.ID)
+	}
+	if filters.UserID != "" {
+		where = append(where, "user_id = ?")
+		params = append(params, filters.UserID)
+	}
+	if filters.Status != "" {
+		where = append(where, "status = ?")
+		params = append(params, filters.Status)
+	}
+	if filters.Visibility != "" {
+		where = append(where, "visibility = ?")
+		params = append(params, filters.Visibility)
+	}
+	if filters.VisibleOnly {
+		where = append(where, "((visibility = ? AND hidden_at IS NULL) OR (user_id IS NOT NULL AND user_id = ?))")
+		params = append(params, domain.VideoVisibilityPublic, filters.ViewerID)
+	}
+	if !filters.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= ?")
+		params = append(params, filters.CreatedAfter.Unix())
+	}
+	if !filters.CreatedBefore.IsZero() {
+		where = append(where, "created_at < ?")
+		params = append(params, filters.CreatedBefore.Unix())
+	}
+
+	return where, params
+}
+
+func (s *videoService) countVideos(ctx context.Context, filters *domain.VideoFilters) (int, error) {
+	where, params := videoConditions(filters)
+
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM videos WHERE `+strings.Join(where, " AND "), params...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+const videoColumns = `id, user_id, title, description, duration, views, key,
+	upload_id, thumbnail_key, visibility, status, width, height, frame_rate,
+	video_codec, rotation, audio_codec, audio_channels, created_at, updated_at, deleted_at, hidden_at`
+
+// scanVideo scans a row selected with videoColumns, followed by any extra destinations
+func (s *videoService) scanVideo(row interface{ Scan(...any) error }, extra ...any) (*domain.Video, error) {
+	var video domain.Video
+	var createdAt int64
+	var updatedAt int64
+	var deletedAt, hiddenAt sql.NullInt64
+	var uploadID sql.NullString
+	var userID sql.NullString
+
+	dest := []any{&video.ID, &userID, &video.Title, &video.Description, &video.Duration, &video.Views, &video.Key, &uploadID, &video.ThumbnailKey,
+		&video.Visibility, &video.Status, &video.Width, &video.Height, &video.FrameRate,
+		&video.VideoCodec, &video.Rotation, &video.AudioCodec, &video.AudioChannels,
+		&createdAt, &updatedAt, &deletedAt, &hiddenAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	video.UploadID = uploadID.String
+	video.UserID = userID.String
+	video.CreatedAt = time.Unix(createdAt, 0)
+	video.UpdatedAt = time.Unix(updatedAt, 0)
+	if deletedAt.Valid {
+		video.DeletedAt = new(time.Time)
+		*video.DeletedAt = time.Unix(deletedAt.Int64, 0)
+	}
+	if hiddenAt.Valid {
+		video.HiddenAt = new(time.Time)
+		*video.HiddenAt = time.Unix(hiddenAt.Int64, 0)
+	}
+	// Set the streaming URL for ready videos
+	video.SetStreamingURL(s.streamingBaseURL)
+
+	return &video, nil
+}
+
+func (s *videoService) findVideos(ctx context.Context, filters *domain.VideoFilters) ([]domain.Video, error) {
+	videos := []domain.Video{}
+
+	where, params := videoConditions(filters)
+
+	var orderClause string
+	if filters != nil && filters.Sort != "" {
+		column := videoSortColumns[filters.Sort]
+		direction, op := "DESC", "<"
+		if filters.Order == domain.SortOrderAsc {
+			direction, op = "ASC", ">"
+		}
+
+		// Keyset pagination, with the ID breaking ties between equal sort values
+		if filters.After != nil {
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op))
+			value := filters.After.SortValue()
+			params = append(params, value, value, filters.After.ID)
+		}
+
+		orderClause = fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction)
+		if filters.Limit > 0 {
+			orderClause += " LIMIT ? OFFSET ?"
+			params = append(params, filters.Limit, filters.Offset)
 		}
 	}
 
 	whereClause := strings.Join(where, " AND ")
 
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT 
-		id, title, description, duration, views, key, 
-		thumbnail_key, visibility, status, created_at, updated_at, deleted_at
-		FROM videos WHERE `+whereClause, params...)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+videoColumns+` FROM videos WHERE `+whereClause+orderClause, params...)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	var createdAt int64
-	var updatedAt int64
-	var deletedAt sql.NullInt64
 	for rows.Next() {
-		var video domain.Video
-		if err := rows.Scan(&video.ID, &video.Title, &video.Description, &video.Duration, &video.Views, &video.Key, &video.ThumbnailKey,
-			&video.Visibility, &video.Status, &createdAt, &updatedAt, &deletedAt); err != nil {
-			return nil, 0, err
-		}
-		video.CreatedAt = time.Unix(createdAt, 0)
-		video.UpdatedAt = time.Unix(updatedAt, 0)
-		if deletedAt.Valid {
-			video.DeletedAt = new(time.Time)
-			*video.DeletedAt = time.Unix(deletedAt.Int64, 0)
+		video, err := s.scanVideo(rows)
+		if err != nil {
+			return nil, err
 		}
-		// Set the streaming URL for ready videos
-		video.SetStreamingURL()
-		videos = append(videos, video)
+		videos = append(videos, *video)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	return videos, count, nil
+	return videos, nil
 
 }
 
-func (s *videoService) CreateVideo(ctx context.Context, payload domain.CreateVideoReq) (*domain.Video, string, error) {
+func (s *videoService) CreateVideo(ctx context.Context, payload domain.CreateVideoReq) (*domain.Video, *domain.VideoUpload, error) {
 
 	err := payload.Validate()
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	var id = uuid.New().String()
 
 	newVideo := domain.Video{
 		ID:          id,
+		UserID:      payload.UserID,
 		Title:       payload.Title,
 		Description: payload.Description,
 		Visibility:  payload.Visibility,
 		Status:      domain.VideoStatusPendingUpload,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
-		Key:         filepath.Join("raw-videos", fmt.Sprintf("%s.mp4", id)),
+		Key:         domain.RawVideoPrefix + id + ".mp4",
 	}
 
 	if err = s.insertVideo(ctx, newVideo); err != nil {
-		return nil, "", err
+		return nil, nil, err
+	}
+
+	upload, err := s.startUpload(ctx, &newVideo, payload)
+	if err != nil {
+		// Without a way to upload it the video could never leave pending_upload
+		if _, dbErr := s.db.ExecContext(context.Background(), `DELETE FROM videos WHERE id = ?`, newVideo.ID); dbErr != nil {
+			slog.Error("failed to delete video after upload setup failed", "videoId", newVideo.ID, "error", dbErr)
+		}
+		return nil, nil, err
+	}
+
+	return &newVideo, upload, nil
+}
+
+// startUpload returns how the client uploads the new video's raw file
+func (s *videoService) startUpload(ctx context.Context, video *domain.Video, payload domain.CreateVideoReq) (*domain.VideoUpload, error) {
+	if payload.UploadMode == domain.UploadModeMultipart {
+		return s.startMultipartUpload(ctx, video, payload.FileSize, payload.ContentType)
 	}
 
-	presignedURL, err := s.storage.GetPresignedURL(ctx, newVideo.Key)
+	presignedURL, err := s.storage.GetPresignedURL(ctx, video.Key, payload.ContentType)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	return &newVideo, presignedURL, nil
+	return &domain.VideoUpload{Mode: domain.UploadModeSingle, PresignedURL: presignedURL, ContentType: payload.ContentType}, nil
 }
 
 func (s *videoService) insertVideo(ctx context.Context, video domain.Video) error {
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO videos (id, title, description, duration, views, key, thumbnail_key, visibility, status, created_at, updated_at, deleted_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		video.ID, video.Title, video.Description, video.Duration, video.Views, video.Key, video.ThumbnailKey, video.Visibility, video.Status, video.CreatedAt.Unix(), video.UpdatedAt.Unix(), nil)
+		`INSERT INTO videos (id, user_id, title, description, duration, views, key, thumbnail_key, visibility, status, created_at, updated_at, deleted_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		video.ID, nullString(video.UserID), video.Title, video.Description, video.Duration, video.Views, video.Key, video.ThumbnailKey, video.Visibility, video.Status, video.CreatedAt.Unix(), video.UpdatedAt.Unix(), nil)
+	return err
+}
+
+// uploadDir uploads every file under dir to storage, keeping its path relative to dir under prefix
+func (s *videoService) uploadDir(ctx context.Context, dir string, prefix string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		return s.storage.Upload(ctx, prefix+"/"+filepath.ToSlash(rel), path)
+	})
+}
+
+// updateMediaInfo stores the probed source details on the video
+func (s *videoService) updateMediaInfo(ctx context.Context, videoID string, info *transcoder.MediaInfo) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE videos SET duration = ?, width = ?, height = ?, frame_rate = ?, video_codec = ?, rotation = ?,
+		audio_codec = ?, audio_channels = ?, updated_at = ? WHERE id = ?`,
+		int(info.Duration.Round(time.Second).Seconds()), info.Width, info.Height, info.FrameRate, info.VideoCodec,
+		info.Rotation, info.AudioCodec, info.AudioChannels, time.Now().Unix(), videoID)
 	return err
 }
 
@@ -173,103 +500,269 @@ func (s *videoService) publishProcessingEvent(videoID string, eventType domain.V
 	s.pubsub.Publish(topic, event.ToJSON())
 }
 
-func (s *videoService) ProcessVideo(ctx context.Context, videoId string) error {
-	video, err := s.GetVideoByID(ctx, videoId)
+// publishProgressEvent publishes a transcoding progress event
+func (s *videoService) publishProgressEvent(videoID string, p transcoder.Progress) {
+	overall := p.OverallPercent
+	variant := p.VariantPercent
+	event := &domain.VideoProcessingEvent{
+		VideoID:         videoID,
+		EventType:       domain.EventTypeVideoProcessingProgress,
+		Status:          domain.VideoStatusProcessing,
+		Message:         fmt.Sprintf("Transcoding %s (%d of %d)", p.Variant, p.VariantIndex+1, p.VariantCount),
+		Progress:        &overall,
+		Variant:         p.Variant,
+		VariantProgress: &variant,
+		Timestamp:       time.Now(),
+	}
+
+	topic := domain.GetVideoProcessingTopic(videoID)
+	s.pubsub.Publish(topic, event.ToJSON())
+}
+
+func (s *videoService) ProcessVideo(ctx context.Context, payload domain.ProcessVideoReq) error {
+	if err := payload.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := s.selectLadder(payload.Renditions); err != nil {
+		return err
+	}
+
+	video, err := s.GetVideoByID(ctx, payload.VideoID)
 	if err != nil {
 		return domain.NewAppError(domain.ErrCodeVideoNotFound, "Video not found", nil)
 	}
 
-	slog.Info("starting video processing", "videoId", video.ID)
-	_, err = s.db.ExecContext(ctx, `UPDATE videos SET status = ?, updated_at = ? WHERE id = ?`, domain.VideoStatusProcessing, time.Now().Unix(), video.ID)
+	switch video.Status {
+	case domain.VideoStatusPendingUpload:
+		return domain.NewAppError(domain.ErrCodeVideoNotUploaded, "Video upload has not been confirmed", nil)
+	case domain.VideoStatusProcessing:
+		return domain.NewAppError(domain.ErrCodeVideoAlreadyProcessing, "Video is already being processed", nil)
+	}
+
+	slog.Info("queueing video processing", "videoId", video.ID)
+	// The status change and the job commit together, so a failed enqueue can't strand the video in processing
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only move from the status read above, so concurrent requests queue the video once
+	result, err := tx.ExecContext(ctx, `UPDATE videos SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		domain.VideoStatusProcessing, time.Now().Unix(), video.ID, video.Status)
 
 	if err != nil {
 		slog.Error("failed to update video status", "error", err)
 		return fmt.Errorf("failed to update video status: %w", err)
 	}
 
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return domain.NewAppError(domain.ErrCodeVideoAlreadyProcessing, "Video is already being processed", nil)
+	}
+
+	job := processVideoPayload{VideoID: video.ID, Renditions: payload.Renditions}
+	if _, err := s.queue.EnqueueTx(ctx, tx, JobTypeProcessVideo, job); err != nil {
+		slog.Error("failed to enqueue video processing job", "videoId", video.ID, "error", err)
+		return fmt.Errorf("failed to enqueue video processing job: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to queue video processing: %w", err)
+	}
+
 	// Publish initial processing event
 	s.publishProcessingEvent(video.ID, domain.EventTypeVideoStatusUpdate, domain.VideoStatusProcessing, "Video processing started", nil, "")
 
-	go func() {
-		s.publishProcessingEvent(videoId, domain.EventTypeVideoProcessingStarted, domain.VideoStatusProcessing, "Video processing started", nil, "")
-		videoName := fmt.Sprintf("%s.mp4", video.ID)
-		tmpDir := filepath.Join(os.TempDir(), "tubbym-backend")
-		rawDir := filepath.Join(tmpDir, "raw-videos")
-		processedDir := filepath.Join(tmpDir, "processed-videos")
-		dst := filepath.Join(rawDir, videoName)
-
-		// Helper function to handle errors and publish error events
-		handleError := func(stage string, err error) {
-			slog.Error("video processing failed", "stage", stage, "videoId", video.ID, "error", err)
-			s.publishProcessingEvent(video.ID, domain.EventTypeVideoProcessingError, domain.VideoStatusError, fmt.Sprintf("Error during %s", stage), nil, err.Error())
-
-			// Update database status to error
-			_, dbErr := s.db.ExecContext(context.TODO(), `UPDATE videos SET status = ?, updated_at = ? WHERE id = ?`, domain.VideoStatusError, time.Now().Unix(), video.ID)
-			if dbErr != nil {
-				slog.Error("failed to update video status to error", "error", dbErr)
-			}
-		}
+	return nil
+}
 
-		if err := os.MkdirAll(rawDir, 0755); err != nil {
-			handleError("directory creation", err)
-			return
-		}
+// selectLadder returns the configured renditions matching names, in ladder
+// order, or the whole ladder when names is empty
+func (s *videoService) selectLadder(names []string) ([]transcoder.Variant, error) {
+	if len(names) == 0 {
+		return s.ladder, nil
+	}
 
-		if err := os.MkdirAll(processedDir, 0755); err != nil {
-			handleError("directory creation", err)
-			return
-		}
+	requested := make(map[string]bool, len(names))
+	for _, name := range names {
+		requested[name] = true
+	}
 
-		err = s.storage.Download(context.TODO(), "raw-videos/"+videoName, dst)
-		if err != nil {
-			handleError("video download", err)
-			return
+	var ladder []transcoder.Variant
+	for _, v := range s.ladder {
+		if requested[v.Name] {
+			ladder = append(ladder, v)
+			delete(requested, v.Name)
 		}
-		defer s.storage.Cleanup(context.TODO(), dst)
+	}
+
+	if len(requested) > 0 {
+		unknown := slices.Sorted(maps.Keys(requested))
+		return nil, domain.NewAppError(domain.ErrCodeInvalidVideoData, fmt.Sprintf("Unknown rendition %q", unknown[0]), nil)
+	}
 
-		// Transcoding phase
-		t := transcoder.New("ffmpeg", tmpDir)
-		slog.Info("starting video transcoding", "videoId", video.ID)
-		transcodingStart := time.Now()
+	return ladder, nil
+}
 
-		outputDir, err := t.TranscodeToHLS(dst)
-		transcodingElapsed := time.Since(transcodingStart)
-		slog.Info("video transcoding completed", "videoId", video.ID, "duration", transcodingElapsed)
-		if err != nil {
-			handleError("video transcoding", err)
-			return
-		}
+// HandleProcessVideoJob runs a queued video processing job. Failures are
+// reported as error events; the video is only marked as errored once the
+// job will not be retried.
+func (s *videoService) HandleProcessVideoJob(ctx context.Context, job *jobs.Job) error {
+	var payload processVideoPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid job payload: %w", err))
+	}
 
-		entries, err := os.ReadDir(outputDir)
-		if err != nil {
-			handleError("reading output directory", err)
-			return
-		}
+	video, err := s.GetVideoByID(ctx, payload.VideoID)
+	if err != nil {
+		return jobs.Permanent(fmt.Errorf("failed to load video %s: %w", payload.VideoID, err))
+	}
+
+	ladder, err := s.selectLadder(payload.Renditions)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
 
-		// Uploading phase
-		slog.Info("uploading transcoded video segments", "videoId", video.ID)
+	stage, err := s.processVideo(ctx, video, ladder)
+	if err == nil {
+		return nil
+	}
 
-		for _, entry := range entries {
-			path := filepath.Join(outputDir, entry.Name())
-			err := s.storage.Upload(context.TODO(), filepath.Join("processed-videos", video.ID, entry.Name()), path)
-			if err != nil {
-				handleError("video upload", err)
-				return
-			}
+	if ctx.Err() != nil {
+		// Interrupted by shutdown; the job is released and resumed later
+		return err
+	}
+
+	slog.Error("video processing failed", "stage", stage, "videoId", video.ID, "attempt", job.Attempts, "error", err)
+
+	if job.IsLastAttempt() || jobs.IsPermanent(err) {
+		s.publishProcessingEvent(video.ID, domain.EventTypeVideoProcessingError, domain.VideoStatusError, fmt.Sprintf("Error during %s", stage), nil, err.Error())
+
+		_, dbErr := s.db.ExecContext(context.Background(), `UPDATE videos SET status = ?, updated_at = ? WHERE id = ?`, domain.VideoStatusError, time.Now().Unix(), video.ID)
+		if dbErr != nil {
+			slog.Error("failed to update video status to error", "error", dbErr)
 		}
+	} else {
+		s.publishProcessingEvent(video.ID, domain.EventTypeVideoProcessingError, domain.VideoStatusProcessing,
+			fmt.Sprintf("Error during %s, retrying (attempt %d of %d)", stage, job.Attempts, job.MaxAttempts), nil, err.Error())
+	}
 
-		slog.Info("video processing completed successfully", "videoId", video.ID)
+	return err
+}
 
-		// Update status to ready
-		_, err = s.db.ExecContext(context.TODO(), `UPDATE videos SET status = ?, updated_at = ? WHERE id = ?`, domain.VideoStatusReady, time.Now().Unix(), video.ID)
-		if err != nil {
-			handleError("database update", err)
+// HandleProcessVideoJobFailed marks the video as errored when its job was
+// abandoned on the last attempt, such as when ffmpeg kept taking the process down
+func (s *videoService) HandleProcessVideoJobFailed(ctx context.Context, job *jobs.Job) {
+	var payload processVideoPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		slog.Error("invalid job payload", "jobId", job.ID, "error", err)
+		return
+	}
+
+	s.publishProcessingEvent(payload.VideoID, domain.EventTypeVideoProcessingError, domain.VideoStatusError, "Processing stopped responding", nil, job.LastError)
+
+	_, err := s.db.ExecContext(ctx, `UPDATE videos SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		domain.VideoStatusError, time.Now().Unix(), payload.VideoID, domain.VideoStatusProcessing)
+	if err != nil {
+		slog.Error("failed to update video status to error", "videoId", payload.VideoID, "error", err)
+	}
+}
+
+// processVideo downloads, transcodes and uploads a video, returning the stage that failed on error
+func (s *videoService) processVideo(ctx context.Context, video *domain.Video, ladder []transcoder.Variant) (string, error) {
+	s.publishProcessingEvent(video.ID, domain.EventTypeVideoProcessingStarted, domain.VideoStatusProcessing, "Video processing started", nil, "")
+	videoName := fmt.Sprintf("%s.mp4", video.ID)
+	tmpDir := filepath.Join(os.TempDir(), "tubbym-backend")
+	rawDir := filepath.Join(tmpDir, "raw-videos")
+	processedDir := filepath.Join(tmpDir, "processed-videos")
+	dst := filepath.Join(rawDir, videoName)
+
+	if err := os.MkdirAll(rawDir, 0755); err != nil {
+		return "directory creation", err
+	}
+
+	if err := os.MkdirAll(processedDir, 0755); err != nil {
+		return "directory creation", err
+	}
+
+	err := s.storage.Download(ctx, domain.RawVideoPrefix+videoName, dst)
+	if err != nil {
+		return "video download", err
+	}
+	defer s.storage.Cleanup(context.Background(), dst)
+
+	t := transcoder.New("ffmpeg", "ffprobe", tmpDir)
+
+	// Probing phase
+	info, err := t.Probe(ctx, dst)
+	if errors.Is(err, transcoder.ErrNoVideoStream) {
+		return "media probing", jobs.Permanent(errors.New("the uploaded file has no video stream"))
+	}
+	if err != nil {
+		return "media probing", err
+	}
+
+	if err := s.updateMediaInfo(ctx, video.ID, info); err != nil {
+		return "database update", err
+	}
+
+	// Transcoding phase
+	slog.Info("starting video transcoding", "videoId", video.ID)
+	transcodingStart := time.Now()
+
+	lastProgress := -1
+	outputDir, err := t.TranscodeToHLS(ctx, dst, info, ladder, func(p transcoder.Progress) {
+		// ffmpeg reports several times a second; only publish when the overall percentage moves
+		if p.OverallPercent == lastProgress {
 			return
 		}
+		lastProgress = p.OverallPercent
+		s.publishProgressEvent(video.ID, p)
+	})
+	transcodingElapsed := time.Since(transcodingStart)
+	slog.Info("video transcoding completed", "videoId", video.ID, "duration", transcodingElapsed)
+	if err != nil {
+		return "video transcoding", err
+	}
+	defer t.Cleanup(outputDir)
 
-		// Publish completion event
-		s.publishProcessingEvent(video.ID, domain.EventTypeVideoProcessingCompleted, domain.VideoStatusReady, "Video processing completed successfully", nil, "")
-	}()
+	// Thumbnail phase
+	thumbsDir, thumbs, err := t.GenerateThumbnails(ctx, dst, info)
+	if err != nil {
+		return "thumbnail generation", err
+	}
+	defer t.Cleanup(thumbsDir)
 
-	return nil
+	// Uploading phase
+	slog.Info("uploading transcoded video segments", "videoId", video.ID)
+	prefix := domain.ProcessedVideoPrefix + video.ID
+
+	if err := s.uploadDir(ctx, outputDir, prefix); err != nil {
+		return "video upload", err
+	}
+
+	if err := s.uploadDir(ctx, thumbsDir, prefix); err != nil {
+		return "thumbnail upload", err
+	}
+
+	slog.Info("video processing completed successfully", "videoId", video.ID)
+
+	// Update status to ready, keeping any thumbnail set on the video, including
+	// a custom one confirmed while it was processing
+	_, err = s.db.ExecContext(ctx, `UPDATE videos SET status = ?, thumbnail_key = COALESCE(NULLIF(thumbnail_key, ''), ?), updated_at = ? WHERE id = ?`,
+		domain.VideoStatusReady, prefix+"/"+thumbs.Poster, time.Now().Unix(), video.ID)
+	if err != nil {
+		return "database update", err
+	}
+
+	// Publish completion event
+	s.publishProcessingEvent(video.ID, domain.EventTypeVideoProcessingCompleted, domain.VideoStatusReady, "Video processing completed successfully", nil, "")
+
+	return "", nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
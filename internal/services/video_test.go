@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/thantko20/tubbym-backend/internal/domain"
+)
+
+// newTestDB creates a database in a temporary directory with every migration applied
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// Search is skipped when SQLite was built without FTS5
+	fts5Err := CheckFTS5(context.Background(), db)
+
+	files, err := filepath.Glob("../db/migrations/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("find migrations: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read migration: %v", err)
+		}
+
+		up, _, _ := strings.Cut(string(data), "-- +goose Down")
+		if fts5Err != nil && strings.Contains(up, "USING fts5") {
+			continue
+		}
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("apply %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return db
+}
+
+// insertListedVideos adds public videos whose sort values tie in every column
+func insertListedVideos(t *testing.T, s *videoService) {
+	t.Helper()
+
+	views := []int{5, 5, 5, 3, 3, 1, 1, 0}
+	for i, v := range views {
+		video := domain.Video{
+			ID:         fmt.Sprintf("video-%02d", i),
+			Title:      []string{"Alpha", "Beta"}[i%2],
+			Views:      v,
+			Key:        fmt.Sprintf("%svideo-%02d.mp4", domain.RawVideoPrefix, i),
+			Visibility: domain.VideoVisibilityPublic,
+			Status:     domain.VideoStatusReady,
+			CreatedAt:  time.Unix(1700000000+int64(i/3), 0),
+			UpdatedAt:  time.Unix(1700000000, 0),
+		}
+		if err := s.insertVideo(context.Background(), video); err != nil {
+			t.Fatalf("insert video: %v", err)
+		}
+	}
+
+	// Not listed, so paging must step over it
+	hidden := domain.Video{ID: "video-private", Title: "Alpha", Key: "raw-videos/video-private.mp4",
+		Visibility: domain.VideoVisibilityPrivate, Status: domain.VideoStatusReady, CreatedAt: time.Unix(1700000000, 0)}
+	if err := s.insertVideo(context.Background(), hidden); err != nil {
+		t.Fatalf("insert video: %v", err)
+	}
+}
+
+func videoIDs(videos []domain.Video) []string {
+	ids := make([]string, len(videos))
+	for i, video := range videos {
+		ids[i] = video.ID
+	}
+	return ids
+}
+
+func TestGetVideosPagesWithoutRepeatsOrGaps(t *testing.T) {
+	s := &videoService{db: newTestDB(t)}
+	insertListedVideos(t, s)
+	ctx := context.Background()
+
+	for _, sort := range []domain.VideoSort{domain.VideoSortCreatedAt, domain.VideoSortViews, domain.VideoSortTitle} {
+		for _, order := range []domain.SortOrder{domain.SortOrderAsc, domain.SortOrderDesc} {
+			t.Run(string(sort)+" "+string(order), func(t *testing.T) {
+				all, total, err := s.GetVideos(ctx, &domain.VideoFilters{Sort: sort, Order: order, Limit: domain.MaxVideoPageSize})
+				if err != nil {
+					t.Fatalf("GetVideos: %v", err)
+				}
+				want := videoIDs(all)
+				if total != 8 || len(want) != 8 {
+					t.Fatalf("listed %d of %d videos, want 8", len(want), total)
+				}
+
+				// Cursor pages
+				var got []string
+				cursor := ""
+				for page := 0; ; page++ {
+					if page > len(want) {
+						t.Fatalf("cursor paging didn't end, got %v", got)
+					}
+					filters := &domain.VideoFilters{Sort: sort, Order: order, Limit: 3, Cursor: cursor}
+					videos, _, err := s.GetVideos(ctx, filters)
+					if err != nil {
+						t.Fatalf("GetVideos page %d: %v", page, err)
+					}
+					got = append(got, videoIDs(videos)...)
+					if cursor = filters.NextCursor(videos); cursor == "" {
+						break
+					}
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("cursor pages = %v, want %v", got, want)
+				}
+
+				// Offset pages
+				got = nil
+				for offset := 0; offset < len(want); offset += 3 {
+					videos, _, err := s.GetVideos(ctx, &domain.VideoFilters{Sort: sort, Order: order, Limit: 3, Offset: offset})
+					if err != nil {
+						t.Fatalf("GetVideos offset %d: %v", offset, err)
+					}
+					got = append(got, videoIDs(videos)...)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("offset pages = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestGetVideosOrdersTiesByID(t *testing.T) {
+	s := &videoService{db: newTestDB(t)}
+	insertListedVideos(t, s)
+
+	videos, _, err := s.GetVideos(context.Background(), &domain.VideoFilters{Sort: domain.VideoSortViews, Order: domain.SortOrderDesc})
+	if err != nil {
+		t.Fatalf("GetVideos: %v", err)
+	}
+	want := []string{"video-02", "video-01", "video-00", "video-04", "video-03", "video-06", "video-05", "video-07"}
+	if got := videoIDs(videos); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,402 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const presignedURLExpiry = 15 * time.Minute
+
+var (
+	ErrInvalidKey       = errors.New("invalid object key")
+	ErrInvalidSignature = errors.New("invalid upload signature")
+	ErrURLExpired       = errors.New("upload URL has expired")
+)
+
+// LocalStorage stores objects in a directory on disk. Upload URLs point back at
+// the API, which verifies their signature before writing the object.
+type LocalStorage struct {
+	baseDir string
+	baseURL string
+	secret  []byte
+
+	mu        sync.RWMutex
+	onCreated ObjectCreatedFunc
+
+	// dirs keeps Delete from pruning a directory Put has just created but not
+	// yet written into
+	dirs sync.RWMutex
+}
+
+// ObjectCreatedFunc is called after an object has been written to local storage
+type ObjectCreatedFunc func(key string, size int64)
+
+func NewLocalStorage(baseDir, baseURL, secret string) (*LocalStorage, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, err
+	}
+
+	absDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	key := []byte(secret)
+	if len(key) == 0 {
+		// Without a configured secret, upload URLs only stay valid until restart
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &LocalStorage{
+		baseDir: absDir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  key,
+	}, nil
+}
+
+// Dir returns the directory objects are stored in
+func (l *LocalStorage) Dir() string {
+	return l.baseDir
+}
+
+func (l *LocalStorage) GetPresignedURL(ctx context.Context, key string, contentType string) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+
+	expires := time.Now().Add(presignedURLExpiry).Unix()
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	if contentType != "" {
+		query.Set("contentType", contentType)
+	}
+	query.Set("signature", l.sign(key, "", 0, contentType, expires))
+
+	return l.baseURL + "/storage/upload/" + escapeKey(key) + "?" + query.Encode(), nil
+}
+
+// VerifyUploadURL checks the expiry and signature of an upload URL issued by
+// GetPresignedURL, or by GetPresignedPartURL when uploadID is set. contentType
+// is the type the URL was signed for, if any.
+func (l *LocalStorage) VerifyUploadURL(key string, uploadID string, partNumber int32, contentType string, expires int64, signature string) error {
+	if time.Now().Unix() > expires {
+		return ErrURLExpired
+	}
+
+	expected := l.sign(key, uploadID, partNumber, contentType, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// OnObjectCreated registers fn to be called whenever an object is written,
+// standing in for the event notifications S3 sends
+func (l *LocalStorage) OnObjectCreated(fn ObjectCreatedFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onCreated = fn
+}
+
+// Put writes the contents of r to the object at key, replacing it atomically
+func (l *LocalStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	// Once the temporary file exists the directory is no longer empty, so it
+	// can't be pruned
+	l.dirs.RLock()
+	tmp, err := createTemp(filepath.Dir(path), ".upload-*")
+	l.dirs.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	l.mu.RLock()
+	onCreated := l.onCreated
+	l.mu.RUnlock()
+	if onCreated != nil {
+		onCreated(key, size)
+	}
+
+	return nil
+}
+
+func (l *LocalStorage) GetObject(ctx context.Context, key string) ([]byte, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+func (l *LocalStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && stat.IsDir()) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Files on disk carry no content type, so sniff it like a browser would
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  sniffContentType(key, head[:n]),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+// sniffContentType detects the content type of an object from its first
+// bytes. Browsers' sniffing misses common video containers such as QuickTime
+// and Matroska, so those are recognised here, with the key's extension as a
+// last resort.
+func sniffContentType(key string, head []byte) string {
+	contentType := http.DetectContentType(head)
+	if contentType != "application/octet-stream" {
+		return contentType
+	}
+
+	// ISO base media files (MP4, MOV) start with a box whose type is at offset 4
+	if len(head) >= 12 {
+		switch string(head[4:8]) {
+		case "ftyp":
+			if string(head[8:12]) == "qt  " {
+				return "video/quicktime"
+			}
+			return "video/mp4"
+		case "moov", "mdat", "wide", "free", "skip", "pnot":
+			return "video/quicktime"
+		}
+	}
+	if bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}) {
+		return "video/x-matroska"
+	}
+
+	if byExtension := mime.TypeByExtension(path.Ext(key)); byExtension != "" {
+		return byExtension
+	}
+	return contentType
+}
+
+func (l *LocalStorage) Download(ctx context.Context, key string, dst string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	return copyFile(path, dst)
+}
+
+func (l *LocalStorage) Upload(ctx context.Context, key string, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return l.Put(ctx, key, file)
+}
+
+func (l *LocalStorage) Cleanup(ctx context.Context, dst string) error {
+	return os.RemoveAll(dst)
+}
+
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Prune directories the deletion left empty, so listing them stays cheap,
+	// stopping at the base directory itself
+	l.dirs.Lock()
+	defer l.dirs.Unlock()
+	base := filepath.Clean(l.baseDir) + string(filepath.Separator)
+	for dir := filepath.Dir(path); strings.HasPrefix(dir, base); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// createTemp creates a temporary file in dir, creating dir first if needed
+func createTemp(dir string, pattern string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, pattern)
+}
+
+func (l *LocalStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	// Only walk the directory the prefix points into
+	root := l.baseDir
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		dir, err := l.path(prefix[:i])
+		if err != nil {
+			return nil, err
+		}
+		root = dir
+	}
+
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(l.baseDir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			// Skip internal state and directories that can't contain matching keys
+			if path != root && (strings.HasPrefix(entry.Name(), ".") || !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") || !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (l *LocalStorage) sign(key string, uploadID string, partNumber int32, contentType string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "PUT\n%s\n%s\n%d\n%s\n%d", key, uploadID, partNumber, contentType, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path resolves key to a file inside the base directory, rejecting keys that escape it
+func (l *LocalStorage) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+
+	// Top-level dot directories hold internal state such as in-progress multipart uploads
+	if strings.HasPrefix(cleaned, ".") {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(l.baseDir, cleaned), nil
+}
+
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
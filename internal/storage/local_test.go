@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocalStorage(t *testing.T) *LocalStorage {
+	t.Helper()
+
+	local, err := NewLocalStorage(t.TempDir(), "http://api.test", "secret")
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	return local
+}
+
+func TestLocalStoragePath(t *testing.T) {
+	local := newTestLocalStorage(t)
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"raw-videos/abc.mp4", "raw-videos/abc.mp4"},
+		{"videos/abc/720p/index.m3u8", "videos/abc/720p/index.m3u8"},
+		{"videos/abc/../def/poster.jpg", "videos/def/poster.jpg"},
+		{"thumbnails/.hidden", "thumbnails/.hidden"},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"../secret", ""},
+		{"videos/../../secret", ""},
+		{"/etc/passwd", ""},
+		{"videos\\..\\..\\secret", ""},
+		{"raw-videos\\abc.mp4", ""},
+		{".multipart/upload/part-1", ""},
+		{".upload-123", ""},
+		{"videos/../.multipart/upload", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := local.path(tt.key)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Fatalf("path(%q) = %q, %v; want ErrInvalidKey", tt.key, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("path(%q): %v", tt.key, err)
+			}
+			if want := filepath.Join(local.Dir(), filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("path(%q) = %q, want %q", tt.key, got, want)
+			}
+		})
+	}
+}
+
+// presignedQuery issues an upload URL for key and returns its query
+func presignedQuery(t *testing.T, local *LocalStorage, key string, contentType string) url.Values {
+	t.Helper()
+
+	raw, err := local.GetPresignedURL(context.Background(), key, contentType)
+	if err != nil {
+		t.Fatalf("GetPresignedURL: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse upload URL: %v", err)
+	}
+	if want := "/storage/upload/" + key; u.Path != want {
+		t.Fatalf("upload URL path = %q, want %q", u.Path, want)
+	}
+	return u.Query()
+}
+
+func TestVerifyUploadURL(t *testing.T) {
+	local := newTestLocalStorage(t)
+	const key = "raw-videos/abc.mp4"
+
+	query := presignedQuery(t, local, key, "video/mp4")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("parse expires: %v", err)
+	}
+	signature := query.Get("signature")
+
+	other, err := NewLocalStorage(t.TempDir(), "http://api.test", "another secret")
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		storage     *LocalStorage
+		key         string
+		contentType string
+		expires     int64
+		signature   string
+		want        error
+	}{
+		{"valid", local, key, "video/mp4", expires, signature, nil},
+		{"other key", local, "raw-videos/def.mp4", "video/mp4", expires, signature, ErrInvalidSignature},
+		{"other content type", local, key, "text/html", expires, signature, ErrInvalidSignature},
+		{"content type dropped", local, key, "", expires, signature, ErrInvalidSignature},
+		{"extended expiry", local, key, "video/mp4", expires + 3600, signature, ErrInvalidSignature},
+		{"tampered signature", local, key, "video/mp4", expires, strings.Repeat("0", len(signature)), ErrInvalidSignature},
+		{"empty signature", local, key, "video/mp4", expires, "", ErrInvalidSignature},
+		{"other secret", other, key, "video/mp4", expires, signature, ErrInvalidSignature},
+		{"expired", local, key, "video/mp4", time.Now().Add(-time.Minute).Unix(), local.sign(key, "", 0, "video/mp4", time.Now().Add(-time.Minute).Unix()), ErrURLExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.storage.VerifyUploadURL(tt.key, "", 0, tt.contentType, tt.expires, tt.signature)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyUploadURLForParts(t *testing.T) {
+	local := newTestLocalStorage(t)
+	ctx := context.Background()
+	const key = "raw-videos/abc.mp4"
+
+	uploadID, err := local.CreateMultipartUpload(ctx, key, "video/mp4")
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	raw, err := local.GetPresignedPartURL(ctx, key, uploadID, 2)
+	if err != nil {
+		t.Fatalf("GetPresignedPartURL: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse part URL: %v", err)
+	}
+	expires, _ := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	signature := u.Query().Get("signature")
+
+	if err := local.VerifyUploadURL(key, uploadID, 2, "", expires, signature); err != nil {
+		t.Fatalf("part URL: %v", err)
+	}
+	// A part URL can't be replayed for another part or as a whole object upload
+	if err := local.VerifyUploadURL(key, uploadID, 3, "", expires, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other part: got %v, want ErrInvalidSignature", err)
+	}
+	if err := local.VerifyUploadURL(key, "", 0, "", expires, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("whole object: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestGetPresignedURLRejectsInvalidKey(t *testing.T) {
+	local := newTestLocalStorage(t)
+
+	if _, err := local.GetPresignedURL(context.Background(), "../secret", ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestLocalStorageList(t *testing.T) {
+	local := newTestLocalStorage(t)
+	ctx := context.Background()
+
+	for _, key := range []string{
+		"raw-videos/a.mp4",
+		"raw-videos/b.mp4",
+		"videos/abc/poster.jpg",
+		"videos/abc/720p/index.m3u8",
+		"videos/abcd/poster.jpg",
+		"videos/xyz/poster.jpg",
+	} {
+		if err := local.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+	// Internal state and dot files are never listed
+	if _, err := local.CreateMultipartUpload(ctx, "raw-videos/c.mp4", "video/mp4"); err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(local.Dir(), "videos", "abc", ".upload-1"), nil, 0644); err != nil {
+		t.Fatalf("write temporary file: %v", err)
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"raw-videos/", []string{"raw-videos/a.mp4", "raw-videos/b.mp4"}},
+		{"videos/abc/", []string{"videos/abc/720p/index.m3u8", "videos/abc/poster.jpg"}},
+		{"videos/abc", []string{"videos/abc/720p/index.m3u8", "videos/abc/poster.jpg", "videos/abcd/poster.jpg"}},
+		{"videos/abc/720p/index", []string{"videos/abc/720p/index.m3u8"}},
+		{"raw", []string{"raw-videos/a.mp4", "raw-videos/b.mp4"}},
+		{"missing/", []string{}},
+		{"", []string{
+			"raw-videos/a.mp4", "raw-videos/b.mp4",
+			"videos/abc/720p/index.m3u8", "videos/abc/poster.jpg",
+			"videos/abcd/poster.jpg", "videos/xyz/poster.jpg",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			objects, err := local.List(ctx, tt.prefix)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			got := []string{}
+			for _, object := range objects {
+				got = append(got, object.Key)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("List(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := local.List(ctx, "../"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("List outside the base directory: got %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestLocalStorageDeletePrunesEmptyDirectories(t *testing.T) {
+	local := newTestLocalStorage(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"videos/abc/720p/index.m3u8", "videos/xyz/poster.jpg"} {
+		if err := local.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	if err := local.Delete(ctx, "videos/abc/720p/index.m3u8"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(local.Dir(), "videos", "abc")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("empty directory videos/abc was kept (err %v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(local.Dir(), "videos", "xyz")); err != nil {
+		t.Errorf("directory with objects was pruned: %v", err)
+	}
+
+	if err := local.Delete(ctx, "videos/xyz/poster.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(local.Dir()); err != nil {
+		t.Errorf("base directory was pruned: %v", err)
+	}
+}
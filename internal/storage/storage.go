@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
 	"time"
@@ -9,14 +10,54 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+var ErrObjectNotFound = errors.New("object not found")
+
+// Multipart uploads allow at most this many parts
+const MaxUploadParts = 10000
+
+const presignedPartURLExpiry = time.Hour
+
+var ErrUploadNotFound = errors.New("multipart upload not found")
+
+// UploadPart describes one uploaded part of a multipart upload
+type UploadPart struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size,omitempty"`
+}
+
+// ObjectInfo holds the metadata of a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
 type Storage interface {
-	GetPresignedURL(ctx context.Context, key string) (string, error)
+	// GetPresignedURL returns a URL the object at key can be uploaded to with a
+	// PUT. When contentType is set, the upload must be sent with that Content-Type.
+	GetPresignedURL(ctx context.Context, key string, contentType string) (string, error)
 	GetObject(ctx context.Context, key string) ([]byte, error)
+	// Stat returns the metadata of the object at key, or ErrObjectNotFound
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
 	Download(ctx context.Context, key string, dst string) error
 	Upload(ctx context.Context, key string, filePath string) error
 	Cleanup(ctx context.Context, dst string) error
+	// Delete removes the object at key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns every object whose key starts with prefix, without their content types
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+
+	// Multipart uploads let clients upload large objects in resumable parts
+	CreateMultipartUpload(ctx context.Context, key string, contentType string) (string, error)
+	GetPresignedPartURL(ctx context.Context, key string, uploadID string, partNumber int32) (string, error)
+	ListParts(ctx context.Context, key string, uploadID string) ([]UploadPart, error)
+	CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []UploadPart) error
+	AbortMultipartUpload(ctx context.Context, key string, uploadID string) error
 }
 
 type S3Storage struct {
@@ -38,13 +79,19 @@ func NewS3Storage(bucket string) (*S3Storage, error) {
 	}, nil
 }
 
-func (s *S3Storage) GetPresignedURL(ctx context.Context, key string) (string, error) {
+func (s *S3Storage) GetPresignedURL(ctx context.Context, key string, contentType string) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
 
-	req, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
-	}, func(opts *s3.PresignOptions) {
+	}
+	if contentType != "" {
+		// Signed as a header, so S3 rejects uploads sent with any other type
+		input.ContentType = aws.String(contentType)
+	}
+
+	req, err := presignClient.PresignPutObject(ctx, input, func(opts *s3.PresignOptions) {
 		opts.Expires = time.Duration(15 * time.Minute)
 	})
 
@@ -74,6 +121,28 @@ func (s *S3Storage) GetObject(ctx context.Context, key string) ([]byte, error) {
 	return data, nil
 }
 
+func (s *S3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(resp.ContentLength),
+		ContentType:  aws.ToString(resp.ContentType),
+		LastModified: aws.ToTime(resp.LastModified),
+	}, nil
+}
+
 func (s *S3Storage) Download(ctx context.Context, key string, dst string) error {
 	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -118,3 +187,136 @@ func (s *S3Storage) Upload(ctx context.Context, key string, filePath string) err
 func (s *S3Storage) Cleanup(ctx context.Context, dst string) error {
 	return os.RemoveAll(dst)
 }
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	return err
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	objects := []ObjectInfo{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func (s *S3Storage) CreateMultipartUpload(ctx context.Context, key string, contentType string) (string, error) {
+	resp, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(resp.UploadId), nil
+}
+
+func (s *S3Storage) GetPresignedPartURL(ctx context.Context, key string, uploadID string, partNumber int32) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	req, err := presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int32(partNumber),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = presignedPartURLExpiry
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL, nil
+}
+
+func (s *S3Storage) ListParts(ctx context.Context, key string, uploadID string) ([]UploadPart, error) {
+	paginator := s3.NewListPartsPaginator(s.client, &s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+
+	parts := []UploadPart{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		var noSuchUpload *types.NoSuchUpload
+		if errors.As(err, &noSuchUpload) {
+			return nil, ErrUploadNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, part := range page.Parts {
+			parts = append(parts, UploadPart{
+				PartNumber: aws.ToInt32(part.PartNumber),
+				ETag:       aws.ToString(part.ETag),
+				Size:       aws.ToInt64(part.Size),
+			})
+		}
+	}
+
+	return parts, nil
+}
+
+func (s *S3Storage) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []UploadPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(part.PartNumber),
+		}
+	}
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+
+	var noSuchUpload *types.NoSuchUpload
+	if errors.As(err, &noSuchUpload) {
+		return ErrUploadNotFound
+	}
+	return err
+}
+
+func (s *S3Storage) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+
+	var noSuchUpload *types.NoSuchUpload
+	if errors.As(err, &noSuchUpload) {
+		return ErrUploadNotFound
+	}
+	return err
+}
@@ -1,72 +1,376 @@
 package transcoder
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Variant struct {
-	Name    string
-	Width   int
-	Height  int
-	Bitrate string
+	Name    string `json:"name"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Bitrate string `json:"bitrate"`
+	// H.264 profile: baseline, main or high
+	Profile      string `json:"profile"`
+	AudioBitrate string `json:"audioBitrate"`
 }
 
-var variants = []Variant{
-	// {Name: "1080p", Width: 1920, Height: 1080, Bitrate: "5000k"},
-	{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k"},
-	{Name: "480p", Width: 854, Height: 480, Bitrate: "1400k"},
+// DefaultLadder is used when no ladder is configured
+var DefaultLadder = []Variant{
+	{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k", Profile: "main", AudioBitrate: "128k"},
+	{Name: "480p", Width: 854, Height: 480, Bitrate: "1400k", Profile: "main", AudioBitrate: "128k"},
 }
 
+var profiles = map[string]bool{"baseline": true, "main": true, "high": true}
+
+// ParseLadder decodes a JSON array of variants, filling in defaults and validating each entry
+func ParseLadder(data []byte) ([]Variant, error) {
+	var ladder []Variant
+	if err := json.Unmarshal(data, &ladder); err != nil {
+		return nil, fmt.Errorf("invalid ladder: %w", err)
+	}
+
+	if len(ladder) == 0 {
+		return nil, fmt.Errorf("ladder must contain at least one variant")
+	}
+
+	seen := make(map[string]bool)
+	for i := range ladder {
+		v := &ladder[i]
+		if v.Profile == "" {
+			v.Profile = "main"
+		}
+		if v.AudioBitrate == "" {
+			v.AudioBitrate = "128k"
+		}
+
+		switch {
+		case v.Name == "":
+			return nil, fmt.Errorf("variant %d: name is required", i)
+		case seen[v.Name]:
+			return nil, fmt.Errorf("variant %s: duplicate name", v.Name)
+		case v.Width <= 0 || v.Height <= 0 || v.Width%2 != 0 || v.Height%2 != 0:
+			return nil, fmt.Errorf("variant %s: width and height must be positive and even", v.Name)
+		case !profiles[v.Profile]:
+			return nil, fmt.Errorf("variant %s: unsupported profile %q", v.Name, v.Profile)
+		}
+
+		if _, err := parseKbps(v.Bitrate); err != nil {
+			return nil, fmt.Errorf("variant %s: %w", v.Name, err)
+		}
+		if _, err := parseKbps(v.AudioBitrate); err != nil {
+			return nil, fmt.Errorf("variant %s: %w", v.Name, err)
+		}
+		seen[v.Name] = true
+	}
+
+	return ladder, nil
+}
+
+// SelectVariants drops variants larger than the source so videos are never
+// upscaled, keeping the smallest one if the source is below every rendition
+func SelectVariants(ladder []Variant, sourceWidth, sourceHeight int) []Variant {
+	if sourceWidth <= 0 || sourceHeight <= 0 {
+		return ladder
+	}
+
+	// Compare short sides so portrait sources are treated like landscape ones
+	sourceShort := min(sourceWidth, sourceHeight)
+
+	var selected []Variant
+	smallest := ladder[0]
+	for _, v := range ladder {
+		if min(v.Width, v.Height) <= sourceShort {
+			selected = append(selected, v)
+		}
+		if min(v.Width, v.Height) < min(smallest.Width, smallest.Height) {
+			smallest = v
+		}
+	}
+
+	if len(selected) == 0 {
+		selected = append(selected, smallest)
+	}
+
+	return selected
+}
+
+// OutputSize returns the dimensions ffmpeg produces when scaling a source of
+// the given size to fit the variant. The variant's box is turned on its side
+// for portrait sources, matching how SelectVariants compares short sides.
+func OutputSize(v Variant, sourceWidth, sourceHeight int) (int, int) {
+	boxWidth, boxHeight := v.Width, v.Height
+	if sourceWidth <= 0 || sourceHeight <= 0 {
+		return boxWidth, boxHeight
+	}
+	if (sourceHeight > sourceWidth) != (boxHeight > boxWidth) {
+		boxWidth, boxHeight = boxHeight, boxWidth
+	}
+
+	// Mirrors scale's force_original_aspect_ratio=decrease:force_divisible_by=2
+	width := min(boxWidth, roundDiv(boxHeight*sourceWidth, sourceHeight))
+	height := min(boxHeight, roundDiv(boxWidth*sourceHeight, sourceWidth))
+	return max(width&^1, 2), max(height&^1, 2)
+}
+
+func roundDiv(a, b int) int {
+	return (a + b/2) / b
+}
+
+// parseKbps parses a bitrate such as "2800k" into kilobits per second
+func parseKbps(bitrate string) (int, error) {
+	kbps, err := strconv.Atoi(strings.TrimSuffix(bitrate, "k"))
+	if err != nil || kbps <= 0 || !strings.HasSuffix(bitrate, "k") {
+		return 0, fmt.Errorf("invalid bitrate %q, expected a value like \"2800k\"", bitrate)
+	}
+	return kbps, nil
+}
+
+// Progress describes how far a transcode has got
+type Progress struct {
+	Variant      string
+	VariantIndex int
+	VariantCount int
+	// Percentage (0-100) of the current variant
+	VariantPercent int
+	// Percentage (0-100) across all variants
+	OverallPercent int
+}
+
+type ProgressFunc func(Progress)
+
 type Transcoder struct {
-	ffmpegPath string
-	tempDir    string
+	ffmpegPath  string
+	ffprobePath string
+	tempDir     string
 }
 
-func New(ffmpegPath, tempDir string) *Transcoder {
+func New(ffmpegPath, ffprobePath, tempDir string) *Transcoder {
 	return &Transcoder{
-		ffmpegPath: ffmpegPath,
-		tempDir:    tempDir,
+		ffmpegPath:  ffmpegPath,
+		ffprobePath: ffprobePath,
+		tempDir:     tempDir,
+	}
+}
+
+// ErrNoVideoStream is returned by Probe for files without a video stream
+var ErrNoVideoStream = errors.New("file has no video stream")
+
+// MediaInfo describes a probed media file
+type MediaInfo struct {
+	Duration   time.Duration
+	Width      int
+	Height     int
+	FrameRate  float64
+	VideoCodec string
+	// Clockwise rotation in degrees the player should apply
+	Rotation      int
+	AudioCodec    string
+	AudioChannels int
+}
+
+// DisplaySize returns the video's dimensions once its rotation is applied,
+// which is what ffmpeg filters see
+func (m *MediaInfo) DisplaySize() (int, int) {
+	if m.Rotation == 90 || m.Rotation == 270 {
+		return m.Height, m.Width
+	}
+	return m.Width, m.Height
+}
+
+type ffprobeStream struct {
+	CodecType    string            `json:"codec_type"`
+	CodecName    string            `json:"codec_name"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	AvgFrameRate string            `json:"avg_frame_rate"`
+	RFrameRate   string            `json:"r_frame_rate"`
+	Channels     int               `json:"channels"`
+	Tags         map[string]string `json:"tags"`
+	SideDataList []struct {
+		Rotation float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// Probe inspects the media file at inputPath with ffprobe, returning
+// ErrNoVideoStream if it has no video to transcode
+func (t *Transcoder) Probe(ctx context.Context, inputPath string) (*MediaInfo, error) {
+	out, err := exec.CommandContext(ctx, t.ffprobePath,
+		"-v", "error",
+		"-show_format",
+		"-show_streams",
+		"-of", "json",
+		inputPath,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("probing media failed: %w", err)
+	}
+
+	var result struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []ffprobeStream `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("decoding ffprobe output failed: %w", err)
+	}
+
+	info := &MediaInfo{}
+	if seconds, err := strconv.ParseFloat(result.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	var hasVideo, hasAudio bool
+	for _, stream := range result.Streams {
+		switch {
+		// Cover art in audio files shows up as a single-frame video stream
+		case stream.CodecType == "video" && !hasVideo && !isAttachedPicture(stream):
+			hasVideo = true
+			info.Width = stream.Width
+			info.Height = stream.Height
+			info.VideoCodec = stream.CodecName
+			info.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			if info.FrameRate == 0 {
+				info.FrameRate = parseFrameRate(stream.RFrameRate)
+			}
+			info.Rotation = streamRotation(stream)
+		case stream.CodecType == "audio" && !hasAudio:
+			hasAudio = true
+			info.AudioCodec = stream.CodecName
+			info.AudioChannels = stream.Channels
+		}
 	}
+
+	if !hasVideo {
+		return nil, ErrNoVideoStream
+	}
+
+	return info, nil
+}
+
+func isAttachedPicture(stream ffprobeStream) bool {
+	switch stream.CodecName {
+	case "mjpeg", "png", "bmp", "gif":
+		return parseFrameRate(stream.AvgFrameRate) == 0
+	}
+	return false
 }
 
-func (t *Transcoder) TranscodeToHLS(inputPath string) (string, error) {
+// parseFrameRate parses ffprobe rates such as "30000/1001"
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(rate, 64)
+		return f
+	}
+
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// streamRotation reads rotation from the display matrix, falling back to the
+// legacy rotate tag, normalised to 0, 90, 180 or 270
+func streamRotation(stream ffprobeStream) int {
+	rotation := 0
+	if value, ok := stream.Tags["rotate"]; ok {
+		rotation, _ = strconv.Atoi(value)
+	}
+	for _, sideData := range stream.SideDataList {
+		if sideData.Rotation != 0 {
+			// The display matrix stores counter-clockwise rotation
+			rotation = -int(sideData.Rotation)
+		}
+	}
+	return ((rotation % 360) + 360) % 360
+}
+
+// TranscodeToHLS transcodes inputPath, described by info from Probe, into an
+// HLS rendition for each variant no larger than the source, plus a master
+// playlist listing the renditions produced. onProgress (if not nil) is called
+// as ffmpeg reports progress.
+func (t *Transcoder) TranscodeToHLS(ctx context.Context, inputPath string, info *MediaInfo, ladder []Variant, onProgress ProgressFunc) (string, error) {
 	outputDir := filepath.Join(t.tempDir, filepath.Base(inputPath)+"-hls")
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return "", err
 	}
 
-	variantPlaylists := []string{}
-	for _, v := range variants {
-		playlist := fmt.Sprintf("%s.m3u8", v.Name)
-		playlistPath := filepath.Join(outputDir, playlist)
+	sourceWidth, sourceHeight := info.DisplaySize()
+	variants := SelectVariants(ladder, sourceWidth, sourceHeight)
+
+	report := func(index, variantPercent int) {
+		if onProgress == nil {
+			return
+		}
+		onProgress(Progress{
+			Variant:        variants[index].Name,
+			VariantIndex:   index,
+			VariantCount:   len(variants),
+			VariantPercent: variantPercent,
+			OverallPercent: (index*100 + variantPercent) / len(variants),
+		})
+	}
+
+	for i, v := range variants {
+		videoKbps, _ := parseKbps(v.Bitrate)
+		playlistPath := filepath.Join(outputDir, v.Name+".m3u8")
+		width, height := OutputSize(v, sourceWidth, sourceHeight)
 		args := []string{
 			"-i", inputPath,
 			"-threads", "1",
-			"-vf", fmt.Sprintf("scale=w=%d:h=%d:force_original_aspect_ratio=decrease:force_divisible_by=2", v.Width, v.Height),
+			"-vf", fmt.Sprintf("scale=w=%d:h=%d", width, height),
 			"-preset", "veryfast",
-			"-c:a", "aac", "-ar", "48000", "-c:v", "h264", "-profile:v", "main",
+			"-c:a", "aac", "-ar", "48000", "-b:a", v.AudioBitrate,
+			"-c:v", "h264", "-profile:v", v.Profile,
 			"-crf", "20", "-sc_threshold", "0",
 			"-g", "48", "-keyint_min", "48",
 			"-b:v", v.Bitrate,
 			"-maxrate", v.Bitrate,
-			"-bufsize", "1200k",
+			"-bufsize", fmt.Sprintf("%dk", videoKbps*2),
 			"-hls_time", "6",
 			"-hls_playlist_type", "vod",
 			"-f", "hls",
 			"-hls_segment_filename", filepath.Join(outputDir, fmt.Sprintf("%s_%%03d.ts", v.Name)),
+			"-progress", "pipe:1",
+			"-nostats",
 			playlistPath,
 		}
 		// cmd := exec.Command(t.ffmpegPath, args...)
-		cmd := exec.Command("nice", append([]string{"-n", "10", "--", t.ffmpegPath}, args...)...)
+		cmd := exec.CommandContext(ctx, "nice", append([]string{"-n", "10", "--", t.ffmpegPath}, args...)...)
 		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
+
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return "", err
+		}
+
+		report(i, 0)
+		if err := cmd.Start(); err != nil {
 			return "", fmt.Errorf("transcoding %s failed: %w", v.Name, err)
 		}
-		variantPlaylists = append(variantPlaylists, playlist)
+
+		readProgress(stdout, info.Duration, func(percent int) {
+			report(i, percent)
+		})
+
+		if err := cmd.Wait(); err != nil {
+			return "", fmt.Errorf("transcoding %s failed: %w", v.Name, err)
+		}
+		report(i, 100)
 	}
 
 	// Create master playlist
@@ -77,12 +381,174 @@ func (t *Transcoder) TranscodeToHLS(inputPath string) (string, error) {
 	}
 	defer master.Close()
 
-	for i, v := range variants {
-		fmt.Fprintf(master, "#EXT-X-STREAM-INF:BANDWIDTH=%s,RESOLUTION=%dx%d\n%s\n",
-			strings.TrimSuffix(v.Bitrate, "k")+"000", v.Width, v.Height, variantPlaylists[i])
+	fmt.Fprintln(master, "#EXTM3U")
+	for _, v := range variants {
+		videoKbps, _ := parseKbps(v.Bitrate)
+		audioKbps, _ := parseKbps(v.AudioBitrate)
+		width, height := OutputSize(v, sourceWidth, sourceHeight)
+		fmt.Fprintf(master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s.m3u8\n",
+			(videoKbps+audioKbps)*1000, width, height, v.Name)
 	}
 
-	return outputDir, nil
+	return outputDir, master.Close()
+}
+
+// readProgress parses the key=value blocks ffmpeg writes with -progress and
+// calls onPercent whenever the completed percentage changes
+func readProgress(r io.Reader, duration time.Duration, onPercent func(int)) {
+	scanner := bufio.NewScanner(r)
+	last := -1
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "out_time_us" || duration <= 0 {
+			continue
+		}
+
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		percent := int(time.Duration(us) * time.Microsecond * 100 / duration)
+		percent = min(max(percent, 0), 99)
+		if percent != last {
+			last = percent
+			onPercent(percent)
+		}
+	}
+	// Drain anything left so ffmpeg never blocks on a full pipe
+	io.Copy(io.Discard, r)
+}
+
+const (
+	candidateCount    = 5
+	spriteTileWidth   = 160
+	spriteTileHeight  = 90
+	spriteColumns     = 10
+	spriteMaxTiles    = 100
+	minSpriteInterval = 5 * time.Second
+)
+
+// Thumbnails lists the images produced by GenerateThumbnails, relative to its output directory
+type Thumbnails struct {
+	Poster     string
+	Candidates []string
+	Sprite     string
+	// WebVTT file mapping time ranges to tiles of the sprite sheet
+	SpriteVTT string
+}
+
+// GenerateThumbnails extracts a poster frame, a set of candidate thumbnails
+// spread across the video, and a sprite sheet with a WebVTT index for scrub
+// previews. Files are written to the returned directory.
+func (t *Transcoder) GenerateThumbnails(ctx context.Context, inputPath string, info *MediaInfo) (string, *Thumbnails, error) {
+	outputDir := filepath.Join(t.tempDir, filepath.Base(inputPath)+"-thumbs")
+	if err := os.MkdirAll(filepath.Join(outputDir, "thumbnails"), 0755); err != nil {
+		return "", nil, err
+	}
+
+	thumbs := &Thumbnails{
+		Poster:    "thumbnail.jpg",
+		Sprite:    "sprite.jpg",
+		SpriteVTT: "sprite.vtt",
+	}
+
+	// Skip the first moments, which are often black frames or fades
+	if err := t.extractFrame(ctx, inputPath, info.Duration/10, 1280, filepath.Join(outputDir, thumbs.Poster)); err != nil {
+		return "", nil, fmt.Errorf("extracting poster frame failed: %w", err)
+	}
+
+	for i := 1; i <= candidateCount; i++ {
+		name := filepath.Join("thumbnails", fmt.Sprintf("candidate_%02d.jpg", i))
+		at := info.Duration * time.Duration(2*i-1) / (2 * candidateCount)
+		if err := t.extractFrame(ctx, inputPath, at, 640, filepath.Join(outputDir, name)); err != nil {
+			return "", nil, fmt.Errorf("extracting candidate thumbnail failed: %w", err)
+		}
+		thumbs.Candidates = append(thumbs.Candidates, filepath.ToSlash(name))
+	}
+
+	interval := minSpriteInterval
+	if info.Duration > interval*spriteMaxTiles {
+		interval = (info.Duration + spriteMaxTiles - 1) / spriteMaxTiles
+	}
+	tiles := max(int((info.Duration+interval-1)/interval), 1)
+	rows := (tiles + spriteColumns - 1) / spriteColumns
+
+	filter := fmt.Sprintf(
+		"fps=1/%f,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+		interval.Seconds(), spriteTileWidth, spriteTileHeight, spriteTileWidth, spriteTileHeight, spriteColumns, rows,
+	)
+	if err := t.runFFmpeg(ctx,
+		"-y", "-i", inputPath,
+		"-vf", filter,
+		"-frames:v", "1",
+		"-q:v", "5",
+		filepath.Join(outputDir, thumbs.Sprite),
+	); err != nil {
+		return "", nil, fmt.Errorf("generating sprite sheet failed: %w", err)
+	}
+
+	if err := writeSpriteVTT(filepath.Join(outputDir, thumbs.SpriteVTT), thumbs.Sprite, info.Duration, interval, tiles); err != nil {
+		return "", nil, fmt.Errorf("writing sprite index failed: %w", err)
+	}
+
+	return outputDir, thumbs, nil
+}
+
+// extractFrame writes the frame at the given offset, scaled to width, as a JPEG
+func (t *Transcoder) extractFrame(ctx context.Context, inputPath string, at time.Duration, width int, outputPath string) error {
+	return t.runFFmpeg(ctx,
+		"-y",
+		"-ss", fmt.Sprintf("%f", at.Seconds()),
+		"-i", inputPath,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=w='min(%d,iw)':h=-2", width),
+		"-q:v", "3",
+		outputPath,
+	)
+}
+
+// ResizeImage re-encodes the image at inputPath as a JPEG of exactly width x
+// height, scaling it to cover the frame and cropping the overflow
+func (t *Transcoder) ResizeImage(ctx context.Context, inputPath string, outputPath string, width, height int) error {
+	return t.runFFmpeg(ctx,
+		"-y", "-i", inputPath,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", width, height, width, height),
+		"-q:v", "3",
+		outputPath,
+	)
+}
+
+func (t *Transcoder) runFFmpeg(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "nice", append([]string{"-n", "10", "--", t.ffmpegPath, "-loglevel", "error"}, args...)...)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func writeSpriteVTT(path, sprite string, duration, interval time.Duration, tiles int) error {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+
+	for i := 0; i < tiles; i++ {
+		start := interval * time.Duration(i)
+		end := min(start+interval, duration)
+		if end <= start {
+			end = start + interval
+		}
+
+		x := (i % spriteColumns) * spriteTileWidth
+		y := (i / spriteColumns) * spriteTileHeight
+		fmt.Fprintf(&b, "%s --> %s\n%s#xywh=%d,%d,%d,%d\n\n",
+			formatVTTTime(start), formatVTTTime(end), sprite, x, y, spriteTileWidth, spriteTileHeight)
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func formatVTTTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
 }
 
 func (t *Transcoder) Cleanup(outputDir string) error {
@@ -0,0 +1,129 @@
+package transcoder
+
+import (
+	"slices"
+	"testing"
+)
+
+var testLadder = []Variant{
+	{Name: "1080p", Width: 1920, Height: 1080},
+	{Name: "720p", Width: 1280, Height: 720},
+	{Name: "480p", Width: 854, Height: 480},
+	{Name: "360p", Width: 640, Height: 360},
+}
+
+func TestParseLadder(t *testing.T) {
+	ladder, err := ParseLadder([]byte(`[
+		{"name": "720p", "width": 1280, "height": 720, "bitrate": "2800k", "profile": "high", "audioBitrate": "192k"},
+		{"name": "360p", "width": 640, "height": 360, "bitrate": "800k"}
+	]`))
+	if err != nil {
+		t.Fatalf("ParseLadder: %v", err)
+	}
+	want := []Variant{
+		{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k", Profile: "high", AudioBitrate: "192k"},
+		{Name: "360p", Width: 640, Height: 360, Bitrate: "800k", Profile: "main", AudioBitrate: "128k"},
+	}
+	if !slices.Equal(ladder, want) {
+		t.Errorf("got %+v, want %+v", ladder, want)
+	}
+}
+
+func TestParseLadderRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not JSON", `{`},
+		{"empty", `[]`},
+		{"missing name", `[{"width": 640, "height": 360, "bitrate": "800k"}]`},
+		{"duplicate name", `[{"name": "360p", "width": 640, "height": 360, "bitrate": "800k"}, {"name": "360p", "width": 640, "height": 360, "bitrate": "800k"}]`},
+		{"odd width", `[{"name": "360p", "width": 641, "height": 360, "bitrate": "800k"}]`},
+		{"missing height", `[{"name": "360p", "width": 640, "bitrate": "800k"}]`},
+		{"unknown profile", `[{"name": "360p", "width": 640, "height": 360, "bitrate": "800k", "profile": "ultra"}]`},
+		{"bitrate without unit", `[{"name": "360p", "width": 640, "height": 360, "bitrate": "800"}]`},
+		{"missing bitrate", `[{"name": "360p", "width": 640, "height": 360}]`},
+		{"bad audio bitrate", `[{"name": "360p", "width": 640, "height": 360, "bitrate": "800k", "audioBitrate": "0k"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ladder, err := ParseLadder([]byte(tt.data)); err == nil {
+				t.Errorf("got %+v, want an error", ladder)
+			}
+		})
+	}
+}
+
+func TestSelectVariants(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		want          []string
+	}{
+		{"1080p landscape", 1920, 1080, []string{"1080p", "720p", "480p", "360p"}},
+		{"720p landscape", 1280, 720, []string{"720p", "480p", "360p"}},
+		{"between rungs", 1000, 562, []string{"480p", "360p"}},
+		{"4:3 landscape", 960, 720, []string{"720p", "480p", "360p"}},
+		{"1080p portrait", 1080, 1920, []string{"1080p", "720p", "480p", "360p"}},
+		{"720p portrait", 720, 1280, []string{"720p", "480p", "360p"}},
+		{"square", 480, 480, []string{"480p", "360p"}},
+		{"smaller than every rung", 320, 180, []string{"360p"}},
+		{"portrait smaller than every rung", 180, 320, []string{"360p"}},
+		{"unknown size", 0, 0, []string{"1080p", "720p", "480p", "360p"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range SelectVariants(testLadder, tt.width, tt.height) {
+				got = append(got, v.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SelectVariants(%dx%d) = %v, want %v", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectVariantsKeepsSmallestWhereverItIs(t *testing.T) {
+	ladder := []Variant{testLadder[3], testLadder[0], testLadder[2]}
+
+	got := SelectVariants(ladder, 160, 90)
+	if len(got) != 1 || got[0].Name != "360p" {
+		t.Errorf("got %+v, want only 360p", got)
+	}
+}
+
+func TestOutputSize(t *testing.T) {
+	p720, p480, p360 := testLadder[1], testLadder[2], testLadder[3]
+
+	tests := []struct {
+		name                  string
+		variant               Variant
+		width, height         int
+		wantWidth, wantHeight int
+	}{
+		{"16:9 landscape", p720, 1920, 1080, 1280, 720},
+		{"16:9 portrait", p720, 1080, 1920, 720, 1280},
+		{"4:3 landscape", p720, 1440, 1080, 960, 720},
+		{"4:3 portrait", p720, 1080, 1440, 720, 960},
+		{"square", p720, 1080, 1080, 720, 720},
+		{"rounds down to even", p480, 1920, 1080, 852, 480},
+		{"rounds down to even portrait", p480, 1080, 1920, 480, 852},
+		// SelectVariants keeps the smallest rung when the source is below every one
+		{"source smaller than every rung", p360, 320, 180, 640, 360},
+		{"portrait source smaller than every rung", p360, 180, 320, 360, 640},
+		{"unknown size", p720, 0, 0, 1280, 720},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height := OutputSize(tt.variant, tt.width, tt.height)
+			if width != tt.wantWidth || height != tt.wantHeight {
+				t.Errorf("OutputSize(%s, %dx%d) = %dx%d, want %dx%d",
+					tt.variant.Name, tt.width, tt.height, width, height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}